@@ -6,6 +6,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/noboruma/s1h/internal/cli"
 	"github.com/noboruma/s1h/internal/config"
@@ -21,6 +23,12 @@ const (
 	masterKeyFileName = "master.key"
 	credsFileName     = "credentials.enc"
 	historyFileName   = "history"
+	groupsFileName    = "groups.json"
+	snippetsFileName  = "snippets.json"
+	recordingsDirName = "recordings"
+	daemonSocketName  = "daemon.sock"
+	daemonLogFileName = "daemon.log"
+	factsFileName     = "facts.json"
 )
 
 func main() {
@@ -37,12 +45,22 @@ func main() {
 		startMainTUI(configs)
 	} else {
 		key, credsFile := loadOrStoreLocalEncryptedFile()
+		daemonSocket := filepath.Join(getConfigDir(), daemonSocketName)
+		if os.Args[1] != "daemon" {
+			ssh.UseDaemon(daemonSocket)
+		}
+		ssh.SetEnvRejectedHandler(func(host string, names []string) {
+			fmt.Fprintf(os.Stderr, "Warning: %s refused the environment variables %s, see AcceptEnv in its sshd_config\n",
+				host, strings.Join(names, ", "))
+		})
 		switch os.Args[1] {
 		case "upsert":
 			var host, password, hostname, user, port string
+			var sudoPassword passwordFlag
 			updateCmd := flag.NewFlagSet("upsert", flag.ExitOnError)
 			updateCmd.StringVar(&host, "host", "", "The host to update")
 			updateCmd.StringVar(&password, "password", "", "The password to set for the host (optional)")
+			updateCmd.Var(&sudoPassword, "sudo-password", "The sudo password to set for the host, prompted for when no value is given, defaults to the password (optional)")
 			updateCmd.StringVar(&hostname, "hostname", "", "The hostname/endpoint to set for the host (optional)")
 			updateCmd.StringVar(&user, "user", "root", "The user to use for the host (optional)")
 			updateCmd.StringVar(&port, "port", "22", "The port to use for the host (optional)")
@@ -63,9 +81,20 @@ func main() {
 					return
 				}
 				password = string(bytePassword)
+				fmt.Println()
+			}
+			if sudoPassword.prompt {
+				fmt.Printf("Enter sudo password for %s:", host)
+				bytePassword, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+				if err != nil {
+					fmt.Println("Error reading password:", err)
+					return
+				}
+				sudoPassword.value = string(bytePassword)
+				fmt.Println()
 			}
 
-			err = credentials.UpsertCredential(credsFile, host, hostname, user, port, password, key)
+			err = credentials.UpsertCredential(credsFile, host, hostname, user, port, password, sudoPassword.value, key)
 			if err != nil {
 				fmt.Println("Error updating credentials:", err)
 				os.Exit(1)
@@ -125,14 +154,162 @@ func main() {
 				os.Exit(1)
 			}
 		case "shell":
-			if len(os.Args) != 3 {
-				fmt.Println("Missing args: s1h shell host")
+			var record, forwardAgent bool
+			var env envFlag
+			recordDir := os.Getenv("S1H_RECORD_DIR")
+			shellCmd := flag.NewFlagSet("shell", flag.ExitOnError)
+			shellCmd.BoolVar(&forwardAgent, "A", false, "Forward the local agent, as with ForwardAgent yes")
+			shellCmd.Var(&env, "e", "Set an environment variable on the host, KEY=VAL (repeatable)")
+			shellCmd.BoolVar(&record, "record", recordDir != "", "Record the session in asciicast format")
+			shellCmd.StringVar(&recordDir, "record-dir", recordDir, "The directory of the recordings (default: $S1H_RECORD_DIR or the s1h config directory)")
+			err := shellCmd.Parse(os.Args[2:])
+			if err != nil {
+				fmt.Println("Error shell:", err)
 				os.Exit(1)
 			}
+			args := shellCmd.Args()
+			if len(args) > 1 && args[1] == "--" {
+				args = append(args[:1], args[2:]...)
+			}
+			if len(args) == 0 {
+				fmt.Println("Missing args: s1h shell [-A] [-e KEY=VAL] [-record] [-record-dir dir] host [-- command args]")
+				os.Exit(1)
+			}
+			if !record {
+				recordDir = ""
+			} else if recordDir == "" {
+				recordDir = filepath.Join(getConfigDir(), recordingsDirName)
+			}
 			configs := loadConfigs()
-			err := cli.Shell(configs, os.Args[2])
+			err = cli.Shell(configs, args[0], strings.Join(args[1:], " "), recordDir, forwardAgent, env)
 			if err != nil {
-				fmt.Println("Error while copying: ", err.Error())
+				fmt.Println("Error in shell: ", err.Error())
+				os.Exit(1)
+			}
+		case "replay":
+			var speed float64
+			var idle time.Duration
+			replayCmd := flag.NewFlagSet("replay", flag.ExitOnError)
+			replayCmd.Float64Var(&speed, "speed", 1, "The playback speed")
+			replayCmd.DurationVar(&idle, "idle", 0, "The longest pause between two outputs (optional)")
+			err := replayCmd.Parse(os.Args[2:])
+			if err != nil {
+				fmt.Println("Error replay:", err)
+				os.Exit(1)
+			}
+			if replayCmd.NArg() != 1 {
+				fmt.Println("Missing args: s1h replay [-speed N] [-idle D] file.cast")
+				os.Exit(1)
+			}
+			err = cli.Replay(replayCmd.Arg(0), speed, idle)
+			if err != nil {
+				fmt.Println("Error while replaying: ", err.Error())
+				os.Exit(1)
+			}
+		case "exec":
+			opts, args := parseExecFlags("exec", os.Args[2:])
+			if len(args) > 1 && args[1] == "--" {
+				args = append(args[:1], args[2:]...)
+			}
+			if len(args) < 2 {
+				fmt.Println("Missing args: s1h exec [-p N] [-timeout D] [-batch N|N%] [-sudo] [-A] [-e KEY=VAL] [-group] [-json] host1,host2,@group -- command args|@snippet key=value")
+				os.Exit(1)
+			}
+			configs := loadConfigs()
+			loadSnippets()
+			command, err := cli.ResolveCommand(args[1:])
+			if err != nil {
+				fmt.Println("Error exec:", err)
+				os.Exit(1)
+			}
+			err = cli.Exec(configs, loadHostGroups(), args[0], command, opts)
+			if err != nil {
+				// stderr keeps the JSON output parsable
+				fmt.Fprintln(os.Stderr, "Error while executing: ", err.Error())
+				os.Exit(1)
+			}
+		case "run":
+			opts, args := parseExecFlags("run", os.Args[2:])
+			var scriptArgs []string
+			for i := range args {
+				if args[i] == "--" {
+					args, scriptArgs = args[:i], args[i+1:]
+					break
+				}
+			}
+			if len(args) < 2 {
+				fmt.Println("Missing args: s1h run [-p N] [-timeout D] [-batch N|N%] [-sudo] [-A] [-e KEY=VAL] [-group] [-json] ./script.sh host1 host2,@group -- args")
+				os.Exit(1)
+			}
+			configs := loadConfigs()
+			err := cli.Run(configs, loadHostGroups(), args[0], strings.Join(args[1:], ","), scriptArgs, opts)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error while running: ", err.Error())
+				os.Exit(1)
+			}
+		case "edit":
+			if len(os.Args) != 3 || os.Args[2] == "" {
+				fmt.Println("Missing args: s1h edit host:/path")
+				os.Exit(1)
+			}
+			configs := loadConfigs()
+			err := cli.Edit(configs, os.Args[2])
+			if err != nil {
+				fmt.Println("Error while editing: ", err.Error())
+				os.Exit(1)
+			}
+		case "daemon":
+			var err error
+			action := ""
+			if len(os.Args) == 3 {
+				action = os.Args[2]
+			}
+			switch action {
+			case "start":
+				err = cli.StartDaemon(daemonSocket, filepath.Join(getConfigDir(), daemonLogFileName))
+			case "run":
+				err = ssh.RunDaemon(daemonSocket, readConfigs)
+			case "status":
+				err = cli.DaemonStatus(daemonSocket)
+			case "stop":
+				err = cli.StopDaemon(daemonSocket)
+			default:
+				fmt.Println("Missing args: s1h daemon start|run|status|stop")
+				os.Exit(1)
+			}
+			if err != nil {
+				fmt.Println("Error daemon:", err)
+				os.Exit(1)
+			}
+		case "facts":
+			var opts cli.FactsOptions
+			factsCmd := flag.NewFlagSet("facts", flag.ExitOnError)
+			factsCmd.BoolVar(&opts.JSON, "json", false, "Print the facts as JSON")
+			factsCmd.BoolVar(&opts.Refresh, "refresh", false, "Gather the facts even when cached")
+			factsCmd.DurationVar(&opts.MaxAge, "max-age", 24*time.Hour, "The age after which cached facts are gathered again")
+			// flags are also accepted after the hosts, e.g. s1h facts host --json
+			var args []string
+			for rest := os.Args[2:]; ; {
+				err := factsCmd.Parse(rest)
+				if err != nil {
+					fmt.Println("Error facts:", err)
+					os.Exit(1)
+				}
+				if factsCmd.NArg() == 0 {
+					break
+				}
+				args = append(args, factsCmd.Arg(0))
+				rest = factsCmd.Args()[1:]
+			}
+			if len(args) == 0 {
+				fmt.Println("Missing args: s1h facts [-json] [-refresh] [-max-age D] host1,host2,@group")
+				os.Exit(1)
+			}
+			configs := loadConfigs()
+			loadFacts()
+			err := cli.Facts(configs, loadHostGroups(), strings.Join(args, ","), opts)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error while gathering facts: ", err.Error())
 				os.Exit(1)
 			}
 		case "ip":
@@ -150,7 +327,7 @@ func main() {
 			fmt.Printf("Could not find: %s\n", os.Args[2])
 			os.Exit(1)
 		default:
-			fmt.Println("Unknown command. Expected 'upsert', 'remove', 'cp', 'shell', 'ip'.")
+			fmt.Println("Unknown command. Expected 'upsert', 'remove', 'cp', 'shell', 'replay', 'exec', 'run', 'edit', 'daemon', 'facts', 'ip'.")
 			os.Exit(1)
 		}
 	}
@@ -169,7 +346,113 @@ func getConfigDir() string {
 	return configDir
 }
 
+// parseExecFlags parses the flags shared by the exec and run commands and
+// returns the remaining arguments.
+func parseExecFlags(name string, args []string) (cli.ExecOptions, []string) {
+	var opts cli.ExecOptions
+	var batch string
+	execCmd := flag.NewFlagSet(name, flag.ExitOnError)
+	execCmd.IntVar(&opts.Parallelism, "p", ssh.DefaultParallelism, "The number of hosts running the command at once (0: all)")
+	execCmd.DurationVar(&opts.Timeout, "timeout", 0, "The timeout per host (optional)")
+	execCmd.DurationVar(&opts.Deadline, "deadline", 0, "The timeout of the whole run (optional)")
+	execCmd.BoolVar(&opts.Group, "group", false, "Group hosts with identical output")
+	execCmd.BoolVar(&opts.JSON, "json", false, "Print results as JSON")
+	execCmd.BoolVar(&opts.Sudo, "sudo", false, "Run the command with sudo, using the stored sudo password")
+	execCmd.BoolVar(&opts.ForwardAgent, "A", false, "Forward the local agent, as with ForwardAgent yes")
+	execCmd.Var((*envFlag)(&opts.Env), "e", "Set an environment variable on the hosts, KEY=VAL (repeatable)")
+	execCmd.StringVar(&batch, "batch", "", "Run hosts by batches of N hosts or N% of the hosts (optional)")
+	execCmd.DurationVar(&opts.Rolling.Pause, "pause", 0, "The pause between batches (optional)")
+	execCmd.StringVar(&opts.Rolling.HealthCheck, "health", "", "A command that must succeed before the next batch (optional)")
+	execCmd.BoolVar(&opts.Rolling.FailFast, "fail-fast", false, "Abort on the first failing batch")
+	err := execCmd.Parse(args)
+	if err != nil {
+		fmt.Printf("Error %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	opts.Rolling.BatchSize, opts.Rolling.BatchPercent, err = ssh.ParseBatch(batch)
+	if err != nil {
+		fmt.Printf("Error %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return opts, execCmd.Args()
+}
+
+// passwordFlag is a password flag given as -flag=VALUE, or alone to prompt
+// for the password.
+type passwordFlag struct {
+	value  string
+	prompt bool
+}
+
+func (f *passwordFlag) String() string {
+	return "" // never print the password
+}
+
+func (f *passwordFlag) Set(value string) error {
+	if value == "true" {
+		f.prompt = true
+	} else {
+		f.value = value
+	}
+	return nil
+}
+
+func (f *passwordFlag) IsBoolFlag() bool {
+	return true
+}
+
+// envFlag collects the KEY=VAL values of a repeated flag.
+type envFlag []ssh.EnvVar
+
+func (f *envFlag) String() string {
+	var vars []string
+	for _, v := range *f {
+		vars = append(vars, v.Name+"="+v.Value)
+	}
+	return strings.Join(vars, " ")
+}
+
+func (f *envFlag) Set(value string) error {
+	v, err := ssh.ParseEnvVar(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, v)
+	return nil
+}
+
+func loadHostGroups() map[string][]string {
+	groups, err := config.LoadHostGroups(filepath.Join(getConfigDir(), groupsFileName))
+	if err != nil {
+		log.Fatalf("Error loading groups: %v\n", err)
+	}
+	return groups
+}
+
+func loadFacts() {
+	err := ssh.LoadFacts(filepath.Join(getConfigDir(), factsFileName))
+	if err != nil {
+		log.Fatalf("Error loading facts: %v\n", err)
+	}
+}
+
+func loadSnippets() {
+	err := ssh.LoadSnippets(filepath.Join(getConfigDir(), snippetsFileName))
+	if err != nil {
+		log.Fatalf("Error loading snippets: %v\n", err)
+	}
+}
+
 func loadConfigs() []ssh.SSHConfig {
+	configs, err := readConfigs()
+	if err != nil {
+		log.Fatalf("Error loading creds: %v\n", err)
+	}
+	return configs
+}
+
+// readConfigs reads the ssh config and fills in the stored credentials.
+func readConfigs() ([]ssh.SSHConfig, error) {
 	configPath := os.Getenv("SSH_CONFIG")
 	if configPath == "" {
 		configPath = filepath.Join(os.Getenv("HOME"), ".ssh", "config")
@@ -177,7 +460,7 @@ func loadConfigs() []ssh.SSHConfig {
 
 	configs, err := ssh.ParseSSHConfig(configPath)
 	if err != nil {
-		log.Fatalf("Error loading creds: %v\n", err)
+		return nil, err
 	}
 
 	configDir := getConfigDir()
@@ -190,11 +473,11 @@ func loadConfigs() []ssh.SSHConfig {
 	if err == nil {
 		creds, err = credentials.LoadCredentials(credsFile, key)
 		if err != nil {
-			log.Fatalf("Error loading creds: %v\n", err)
+			return nil, err
 		}
 		configs = config.PopulateCredentialsToConfig(creds, configs)
 	}
-	return configs
+	return configs, nil
 }
 
 func startMainTUI(configs []ssh.SSHConfig) {
@@ -207,6 +490,9 @@ func startMainTUI(configs []ssh.SSHConfig) {
 	if err != nil {
 		log.Fatalf("Error loading scp history")
 	}
+	loadSnippets()
+	loadFacts()
+	tui.SetRecordDir(os.Getenv("S1H_RECORD_DIR"))
 
 	tui.DisplaySSHConfig(configs)
 }
@@ -4,6 +4,7 @@ go 1.25.0
 
 require (
 	github.com/gdamore/tcell/v2 v2.13.4
+	github.com/hinshun/vt10x v0.0.0-20220119200601-820417d04eec
 	github.com/pkg/sftp v1.13.10
 	github.com/rivo/tview v0.42.0
 	golang.org/x/crypto v0.46.0
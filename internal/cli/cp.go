@@ -1,9 +1,8 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -20,14 +19,6 @@ func extractHost(endpoint string) string {
 	return endpoint[:n]
 }
 
-func removeSlashes(input string) string {
-	return strings.ReplaceAll(
-		strings.ReplaceAll(
-			strings.ReplaceAll(input, fmt.Sprintf("%c", os.PathSeparator), "_"),
-			"@", "_"),
-		":", "_")
-}
-
 func extractPath(endpoint string) string {
 	n := strings.Index(endpoint, ":")
 	if n == -1 {
@@ -73,14 +64,8 @@ func Copy(configs []ssh.SSHConfig, left, right string) error {
 			if err != nil {
 				return err
 			}
-			tempPath := filepath.Join(os.TempDir(),
-				removeSlashes("s1h"+left+right))
-			err = ssh.DownloadFile(leftClient, extractPath(left), tempPath, &progress)
-			if err != nil {
-				return err
-			}
-			defer os.Remove(tempPath)
-			err = ssh.UploadFile(rightClient, tempPath, extractPath(right), &progress)
+			err = ssh.CopyRemoteToRemote(leftClient, rightClient,
+				extractPath(left), extractPath(right), &progress)
 		} else { // remote -> local
 			err = ssh.DownloadFile(leftClient, extractPath(left), right, &progress)
 		}
@@ -99,12 +84,25 @@ func Copy(configs []ssh.SSHConfig, left, right string) error {
 	return err
 }
 
-func Shell(configs []ssh.SSHConfig, host string) error {
+// Shell opens an interactive shell on host, or runs command when set. The
+// session is recorded in recordDir when set, env is set on top of the SendEnv
+// and SetEnv of the host.
+func Shell(configs []ssh.SSHConfig, host, command, recordDir string, forwardAgent bool, env []ssh.EnvVar) error {
 	cfg, has := findConfig(configs, host)
 	if !has {
 		return fmt.Errorf("config %s not found", host)
 	}
-	return ssh.ExecuteSSHShell(cfg)
+	cfg.ForwardAgent = cfg.ForwardAgent || forwardAgent
+	cfg.SetEnv = append(cfg.SetEnv, env...)
+	recording, err := ssh.ExecuteSSHShell(cfg, command, recordDir)
+	if errors.Is(err, ssh.ErrDisconnected) {
+		fmt.Printf("Connection to %s closed.\n", host)
+		err = nil
+	}
+	if recording != "" {
+		fmt.Println("Session recorded to", recording)
+	}
+	return err
 }
 
 type progressWriter struct {
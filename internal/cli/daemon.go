@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/noboruma/s1h/internal/ssh"
+)
+
+// StartDaemon runs "s1h daemon run" in the background, detached from the
+// terminal, its output going to logPath. It returns once the daemon answers.
+func StartDaemon(socket, logPath string) error {
+	if status, err := ssh.DaemonStatusOf(socket); err == nil {
+		fmt.Printf("s1h daemon already running (pid %d)\n", status.PID)
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(self, "daemon", "run")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("daemon exited (%v), see %s", err, logPath)
+		case <-time.After(50 * time.Millisecond):
+		}
+		if status, err := ssh.DaemonStatusOf(socket); err == nil {
+			fmt.Printf("s1h daemon started (pid %d)\n", status.PID)
+			return nil
+		}
+	}
+	return fmt.Errorf("daemon did not start, see %s", logPath)
+}
+
+// DaemonStatus prints the connections held by the daemon.
+func DaemonStatus(socket string) error {
+	status, err := ssh.DaemonStatusOf(socket)
+	if errors.Is(err, ssh.ErrNoDaemon) {
+		fmt.Println("s1h daemon not running")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("s1h daemon running (pid %d) since %s on %s\n",
+		status.PID, status.Started.Format(time.DateTime), socket)
+	if len(status.Connections) == 0 {
+		fmt.Println("No connection")
+	}
+	for _, conn := range status.Connections {
+		if conn.Users > 0 {
+			fmt.Printf("%s\tin use by %d\n", conn.Host, conn.Users)
+		} else {
+			fmt.Printf("%s\tidle for %s\n", conn.Host, conn.Idle.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// StopDaemon stops the daemon, closing its connections.
+func StopDaemon(socket string) error {
+	err := ssh.StopDaemon(socket)
+	if errors.Is(err, ssh.ErrNoDaemon) {
+		fmt.Println("s1h daemon not running")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("s1h daemon stopped")
+	return nil
+}
@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/noboruma/s1h/internal/ssh"
+)
+
+func Edit(configs []ssh.SSHConfig, target string) error {
+	host := extractHost(target)
+	if host == "" {
+		return fmt.Errorf("missing host in %s", target)
+	}
+	cfg, has := findConfig(configs, host)
+	if !has {
+		return fmt.Errorf("config %s not found", host)
+	}
+	client, err := ssh.SSHClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	err = ssh.EditRemoteFile(client, extractPath(target))
+	if errors.Is(err, ssh.ErrFileUnchanged) {
+		fmt.Println("No changes.")
+		return nil
+	}
+	var changedErr *ssh.RemoteChangedError
+	if errors.As(err, &changedErr) {
+		fmt.Println(changedErr.Diff)
+	}
+	return err
+}
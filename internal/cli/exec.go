@@ -0,0 +1,208 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/noboruma/s1h/internal/ssh"
+)
+
+type ExecOptions struct {
+	ssh.MultiExecOptions
+	Rolling ssh.RollingOptions
+	Group   bool
+	JSON    bool
+	// ForwardAgent forwards the local agent to every host, not only the ones
+	// configured with ForwardAgent.
+	ForwardAgent bool
+	// Env is set on every host, on top of its SendEnv and SetEnv.
+	Env []ssh.EnvVar
+}
+
+type jsonResult struct {
+	Host       string `json:"host"`
+	ExitCode   int    `json:"exit_code"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	DurationMs int64  `json:"duration_ms"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ResolveHosts expands a comma separated list of hosts and @groups.
+func ResolveHosts(configs []ssh.SSHConfig, groups map[string][]string, spec string) ([]ssh.SSHConfig, error) {
+	var hosts []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if group, isGroup := strings.CutPrefix(name, "@"); isGroup {
+			members, has := groups[group]
+			if !has {
+				return nil, fmt.Errorf("group %s not found", group)
+			}
+			hosts = append(hosts, members...)
+		} else {
+			hosts = append(hosts, name)
+		}
+	}
+
+	var selected []ssh.SSHConfig
+	seen := map[string]struct{}{}
+	for _, host := range hosts {
+		if _, has := seen[host]; has {
+			continue
+		}
+		seen[host] = struct{}{}
+		cfg, has := findConfig(configs, host)
+		if !has {
+			return nil, fmt.Errorf("config %s not found", host)
+		}
+		selected = append(selected, cfg)
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("no host selected")
+	}
+	return selected, nil
+}
+
+// Exec runs command on every host of hostSpec. Output lines are prefixed with
+// the host name unless grouped or JSON output is requested. An error is
+// returned when any host fails.
+func Exec(configs []ssh.SSHConfig, groups map[string][]string, hostSpec, command string, opts ExecOptions) error {
+	selectedConfigs, err := ResolveHosts(configs, groups, hostSpec)
+	if err != nil {
+		return err
+	}
+
+	if opts.Sudo {
+		opts.SudoPasswords = ssh.SudoPasswords(selectedConfigs)
+	}
+	if opts.ForwardAgent {
+		for i := range selectedConfigs {
+			selectedConfigs[i].ForwardAgent = true
+		}
+	}
+	for i := range selectedConfigs {
+		selectedConfigs[i].SetEnv = append(selectedConfigs[i].SetEnv, opts.Env...)
+	}
+
+	width := 0
+	for _, cfg := range selectedConfigs {
+		width = max(width, len(cfg.Host))
+	}
+	if !opts.Group && !opts.JSON {
+		opts.OnLine = func(host, line string, stderr bool) {
+			out := os.Stdout
+			if stderr {
+				out = os.Stderr
+			}
+			fmt.Fprintf(out, "%-*s: %s\n", width, host, line)
+		}
+	}
+
+	var results []ssh.ExecResult
+	var abort error
+	if opts.Rolling.Enabled() {
+		opts.Rolling.OnBatch = func(batch, batches int, hosts []string) {
+			fmt.Fprintf(os.Stderr, "== batch %d/%d: %s\n", batch, batches, ssh.FoldHosts(hosts))
+		}
+		results, abort = ssh.RollingExec(context.Background(), selectedConfigs, command,
+			opts.MultiExecOptions, opts.Rolling, nil)
+	} else {
+		results = ssh.DialAndExecOnMany(context.Background(), selectedConfigs, command,
+			opts.MultiExecOptions, nil)
+	}
+
+	switch {
+	case opts.JSON:
+		err = printJSONResults(os.Stdout, results)
+		if err != nil {
+			return err
+		}
+	case opts.Group:
+		PrintGroupedResults(os.Stdout, results)
+	}
+
+	failed := 0
+	for _, res := range results {
+		if !res.Failed() {
+			continue
+		}
+		failed++
+		if opts.JSON {
+			continue
+		}
+		switch {
+		case res.TimedOut:
+			fmt.Fprintf(os.Stderr, "%-*s: timeout after %s\n", width, res.Host, res.Duration)
+		case res.Err != nil:
+			fmt.Fprintf(os.Stderr, "%-*s: %v\n", width, res.Host, res.Err)
+		default:
+			fmt.Fprintf(os.Stderr, "%-*s: exit %d\n", width, res.Host, res.ExitCode)
+		}
+	}
+	if abort != nil {
+		return fmt.Errorf("rolling execution aborted: %w", abort)
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d/%d hosts failed", failed, len(results))
+	}
+	return nil
+}
+
+// Run feeds a local script to every host of hostSpec and runs it with args,
+// reporting like Exec.
+func Run(configs []ssh.SSHConfig, groups map[string][]string, scriptPath, hostSpec string, args []string, opts ExecOptions) error {
+	script, err := ssh.LoadScript(scriptPath, args)
+	if err != nil {
+		return err
+	}
+	opts.Stdin = script.Content
+	return Exec(configs, groups, hostSpec, script.Command(), opts)
+}
+
+func printJSONResults(w io.Writer, results []ssh.ExecResult) error {
+	out := make([]jsonResult, len(results))
+	for i, res := range results {
+		out[i] = jsonResult{
+			Host:       res.Host,
+			ExitCode:   res.ExitCode,
+			Stdout:     string(res.Stdout),
+			Stderr:     string(res.Stderr),
+			DurationMs: res.Duration.Milliseconds(),
+			TimedOut:   res.TimedOut,
+		}
+		if res.Err != nil {
+			out[i].Error = res.Err.Error()
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// PrintGroupedResults prints results collapsed by identical output, the way
+// dshbak does.
+func PrintGroupedResults(w io.Writer, results []ssh.ExecResult) {
+	for _, group := range ssh.GroupResults(results) {
+		hosts := ssh.FoldHosts(group.Hosts)
+		status := fmt.Sprintf("exit %d", group.Result.ExitCode)
+		if group.Result.TimedOut {
+			status = "timeout"
+		} else if group.Result.Err != nil {
+			status = group.Result.Err.Error()
+		}
+		header := fmt.Sprintf("%s (%d hosts, %s)", hosts, len(group.Hosts), status)
+		separator := strings.Repeat("-", len(header))
+		fmt.Fprintf(w, "%s\n%s\n%s\n", separator, header, separator)
+		w.Write(group.Result.Stdout)
+		w.Write(group.Result.Stderr)
+	}
+}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/noboruma/s1h/internal/ssh"
+)
+
+type FactsOptions struct {
+	JSON bool
+	// Refresh gathers the facts even when cached facts are younger than
+	// MaxAge.
+	Refresh bool
+	MaxAge  time.Duration
+}
+
+// factsTimeout bounds gathering the facts of a connected host, connecting is
+// bounded by S1H_TIMEOUT_SEC.
+const factsTimeout = 30 * time.Second
+
+// jsonFacts holds the facts of a host, nil when they are unknown.
+type jsonFacts struct {
+	Host string `json:"host"`
+	*ssh.HostFacts
+	Error string `json:"error,omitempty"`
+}
+
+// Facts prints the facts of every host of hostSpec, gathering the ones that
+// are not cached or older than opts.MaxAge. An error is returned when the
+// facts of a host are unknown.
+func Facts(configs []ssh.SSHConfig, groups map[string][]string, hostSpec string, opts FactsOptions) error {
+	selectedConfigs, err := ResolveHosts(configs, groups, hostSpec)
+	if err != nil {
+		return err
+	}
+
+	results := make([]jsonFacts, len(selectedConfigs))
+	sem := make(chan struct{}, ssh.DefaultParallelism)
+	var wg sync.WaitGroup
+	for i, cfg := range selectedConfigs {
+		results[i].Host = cfg.Host
+		facts, has := ssh.CachedFacts(cfg.Host)
+		if has {
+			results[i].HostFacts = &facts
+		}
+		if has && !opts.Refresh && time.Since(facts.Collected) < opts.MaxAge {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, cfg ssh.SSHConfig) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			facts, err := gatherFacts(cfg)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].HostFacts = &facts
+			err = ssh.StoreFacts(facts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: caching facts: %v\n", cfg.Host, err)
+			}
+		}(i, cfg)
+	}
+	wg.Wait()
+
+	if opts.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+		if err != nil {
+			return err
+		}
+	} else {
+		for i, res := range results {
+			if i > 0 {
+				fmt.Println()
+			}
+			printFacts(res)
+		}
+	}
+	return unknownFacts(results)
+}
+
+// unknownFacts reports the hosts whose facts are unknown, a host whose refresh
+// failed still has its cached facts shown along with the error.
+func unknownFacts(results []jsonFacts) error {
+	failed := 0
+	for _, res := range results {
+		if res.HostFacts == nil {
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d/%d hosts failed", failed, len(results))
+	}
+	return nil
+}
+
+func gatherFacts(cfg ssh.SSHConfig) (ssh.HostFacts, error) {
+	client, err := ssh.SSHClient(cfg)
+	if err != nil {
+		return ssh.HostFacts{}, err
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), factsTimeout)
+	defer cancel()
+	return ssh.GatherFacts(ctx, client, cfg.Host)
+}
+
+func printFacts(res jsonFacts) {
+	if res.HostFacts == nil {
+		fmt.Printf("%s (never collected)\n", res.Host)
+	} else {
+		fmt.Printf("%s (collected %s)\n", res.Host, res.Collected.Format(time.DateTime))
+	}
+	if res.Error != "" {
+		fmt.Printf("  %-11s %s\n", "Error:", res.Error)
+	}
+	if res.HostFacts != nil {
+		for _, field := range res.Summary() {
+			fmt.Printf("  %-11s %s\n", field[0]+":", field[1])
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/noboruma/s1h/internal/ssh"
+)
+
+func TestUnknownFacts(t *testing.T) {
+	known := &ssh.HostFacts{Host: "web01"}
+	tests := []struct {
+		name    string
+		results []jsonFacts
+		wantErr string
+	}{
+		{name: "none"},
+		{
+			name:    "gathered",
+			results: []jsonFacts{{Host: "web01", HostFacts: known}},
+		},
+		{
+			name:    "stale cache",
+			results: []jsonFacts{{Host: "web01", HostFacts: known, Error: "connection refused"}},
+		},
+		{
+			name:    "never collected",
+			results: []jsonFacts{{Host: "web02", Error: "connection refused"}},
+			wantErr: "1/1 hosts failed",
+		},
+		{
+			name: "mixed",
+			results: []jsonFacts{
+				{Host: "web01", HostFacts: known, Error: "connection refused"},
+				{Host: "web02", Error: "connection refused"},
+				{Host: "web03", HostFacts: known},
+			},
+			wantErr: "1/3 hosts failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := unknownFacts(tt.results)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unknownFacts() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("unknownFacts() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
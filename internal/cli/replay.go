@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/noboruma/s1h/internal/ssh"
+	"golang.org/x/term"
+)
+
+// Replay plays an asciicast recording back in the terminal, speed times
+// faster. Pauses longer than maxIdle are shortened to maxIdle when it is set.
+func Replay(path string, speed float64, maxIdle time.Duration) error {
+	if speed <= 0 {
+		return fmt.Errorf("speed must be positive")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	header, events, err := ssh.ReadCast(file)
+	if err != nil {
+		return err
+	}
+
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err == nil && (width < header.Width || height < header.Height) {
+		fmt.Fprintf(os.Stderr, "The recording is %dx%d, the terminal is only %dx%d\n",
+			header.Width, header.Height, width, height)
+	}
+
+	var last float64
+	for _, event := range events {
+		wait := time.Duration((event.Time - last) * float64(time.Second) / speed)
+		if maxIdle > 0 && wait > maxIdle {
+			wait = maxIdle
+		}
+		time.Sleep(wait)
+		last = event.Time
+		if event.Type == "o" {
+			_, err = os.Stdout.WriteString(event.Data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/noboruma/s1h/internal/ssh"
+)
+
+// ResolveCommand turns command args into the command to run. "@name
+// key=value..." calls a snippet, its missing values are prompted.
+func ResolveCommand(args []string) (string, error) {
+	snippet, values, ok, err := ssh.ParseSnippetCall(args)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return strings.Join(args, " "), nil
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for _, placeholder := range snippet.Placeholders() {
+		if values[placeholder.Name] != "" || placeholder.Default != "" {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: ", placeholder.Name)
+		value, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", placeholder.Name, err)
+		}
+		values[placeholder.Name] = strings.TrimSpace(value)
+	}
+	return snippet.Expand(values)
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// LoadHostGroups reads the host groups file, a JSON object mapping a group
+// name to its hosts, e.g. {"web": ["web01", "web02"]}. A missing file means
+// no groups.
+func LoadHostGroups(path string) (map[string][]string, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string][]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]string{}
+	err = json.Unmarshal(b, &groups)
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
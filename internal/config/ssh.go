@@ -10,6 +10,7 @@ func PopulateCredentialsToConfig(creds credentials.Credentials, configs []ssh.SS
 	for i, cfg := range configs {
 		cred := creds.Entries[cfg.Host]
 		cfg.Password = cred.Password
+		cfg.SudoPassword = cred.SudoPassword
 		if cred.Hostname != "" { // Replace outdated data
 			cfg.HostName = cred.Hostname
 			cfg.User = cred.User
@@ -33,6 +34,7 @@ func PopulateCredentialsToConfig(creds credentials.Credentials, configs []ssh.SS
 			HostName:     added.Hostname,
 			IdentityFile: "",
 			Password:     added.Password,
+			SudoPassword: added.SudoPassword,
 		})
 	}
 	return configs
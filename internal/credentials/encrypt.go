@@ -12,10 +12,11 @@ import (
 )
 
 type Entry struct {
-	Password string `json:"password"`
-	Hostname string `json:"hostname"`
-	User     string `json:"user"`
-	Port     string `json:"port"`
+	Password     string `json:"password"`
+	SudoPassword string `json:"sudo_password,omitempty"`
+	Hostname     string `json:"hostname"`
+	User         string `json:"user"`
+	Port         string `json:"port"`
 }
 
 type Credentials struct {
@@ -135,7 +136,7 @@ func saveCredentials(filename string, creds Credentials, key []byte) error {
 	return nil
 }
 
-func UpsertCredential(filename string, host, hostname, user, port string, password string, key []byte) error {
+func UpsertCredential(filename string, host, hostname, user, port string, password, sudoPassword string, key []byte) error {
 	creds, err := LoadCredentials(filename, key)
 	if err != nil && !os.IsNotExist(err) {
 		return err
@@ -145,8 +146,12 @@ func UpsertCredential(filename string, host, hostname, user, port string, passwo
 		creds.Entries = make(map[string]Entry)
 	}
 
+	if sudoPassword == "" { // keep the previous one
+		sudoPassword = creds.Entries[host].SudoPassword
+	}
 	entry := Entry{
-		Password: password,
+		Password:     password,
+		SudoPassword: sudoPassword,
 	}
 	if hostname != "" {
 		entry.Hostname = hostname
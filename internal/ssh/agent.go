@@ -0,0 +1,70 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	cssh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	agentChannelType = "auth-agent@openssh.com"
+	agentRequestType = "auth-agent-req@openssh.com"
+)
+
+var errNoAgent = errors.New("no local agent, SSH_AUTH_SOCK is not set")
+
+// agentClients holds the clients whose sessions forward the local agent.
+var agentClients sync.Map // *cssh.Client -> struct{}
+
+// forwardAgent serves the agent requests of the host with the agent of
+// SSH_AUTH_SOCK, every session of the client then requests forwarding.
+func forwardAgent(client *cssh.Client) error {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return errNoAgent
+	}
+	err := agent.ForwardToRemote(client, socket)
+	if err != nil {
+		return err
+	}
+	agentClients.Store(client, struct{}{})
+	go func() {
+		_ = client.Wait()
+		agentClients.Delete(client)
+	}()
+	return nil
+}
+
+// newSession opens a session, requesting agent forwarding when the client
+// forwards the agent and setting the environment of the client.
+func newSession(client *cssh.Client) (*cssh.Session, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	if _, has := agentClients.Load(client); has {
+		err = agent.RequestAgentForwarding(session)
+		if err != nil {
+			session.Close()
+			return nil, fmt.Errorf("agent forwarding refused: %w", err)
+		}
+	}
+	sendEnv(client, session)
+	return session, nil
+}
+
+// AgentForwarding describes whether connections to the host forward the
+// local agent.
+func (c SSHConfig) AgentForwarding() string {
+	switch {
+	case !c.ForwardAgent:
+		return "no"
+	case os.Getenv("SSH_AUTH_SOCK") == "":
+		return "yes, but " + errNoAgent.Error()
+	}
+	return "yes"
+}
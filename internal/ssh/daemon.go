@@ -0,0 +1,408 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	cssh "golang.org/x/crypto/ssh"
+)
+
+// The daemon is a local SSH server multiplexing the sessions of the CLI
+// commands over the connections it keeps open, like an OpenSSH ControlMaster.
+// A client connects to its unix socket and sends one of these requests.
+const (
+	daemonConnectRequest = "connect@s1h" // payload: host, reply: error text
+	daemonStatusRequest  = "status@s1h"  // reply: DaemonStatus as JSON
+	daemonStopRequest    = "stop@s1h"
+	daemonVersionRequest = "version@s1h" // reply: version of the host server
+)
+
+// DaemonStatus is reported by a running daemon.
+type DaemonStatus struct {
+	PID         int        `json:"pid"`
+	Started     time.Time  `json:"started"`
+	Connections []PoolStat `json:"connections"`
+}
+
+// serverVersions holds the version of the host of the clients connected
+// through the daemon.
+var serverVersions sync.Map // *cssh.Client -> string
+
+// ServerVersion returns the version announced by the host of the client.
+func ServerVersion(client *cssh.Client) string {
+	if version, has := serverVersions.Load(client); has {
+		return version.(string)
+	}
+	return string(client.ServerVersion())
+}
+
+// ErrNoDaemon is returned when no daemon listens on the socket.
+var ErrNoDaemon = errors.New("daemon not running")
+
+var daemonSocket string
+
+// UseDaemon makes SSHClient go through the daemon listening on socket when
+// there is one, an empty socket dials the hosts directly.
+func UseDaemon(socket string) {
+	daemonSocket = socket
+}
+
+type daemon struct {
+	pool     *Pool
+	configs  func() ([]SSHConfig, error)
+	config   *cssh.ServerConfig
+	started  time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// the client connections requesting agent forwarding per host connection,
+	// the agent requests of a host go to the last one
+	agentMu      sync.Mutex
+	agentTargets map[*cssh.Client][]*cssh.ServerConn
+}
+
+// RunDaemon serves the daemon on socket until it is stopped by a stop request
+// or a signal. configs is called to look up the hosts each time one is
+// connected, so that config and credential changes are picked up.
+func RunDaemon(socket string, configs func() ([]SSHConfig, error)) error {
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return fmt.Errorf("a daemon is already listening on %s", socket)
+	}
+	_ = os.Remove(socket) // left over by a daemon that did not stop cleanly
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	signer, err := cssh.NewSignerFromKey(key)
+	if err != nil {
+		return err
+	}
+	d := &daemon{
+		pool:    NewPool(nil),
+		configs: configs,
+		config:  &cssh.ServerConfig{NoClientAuth: true},
+		started: time.Now(),
+		stop:    make(chan struct{}),
+
+		agentTargets: make(map[*cssh.Client][]*cssh.ServerConn),
+	}
+	d.config.AddHostKey(signer)
+
+	// only the user may connect
+	umask := syscall.Umask(0o077)
+	listener, err := net.Listen("unix", socket)
+	syscall.Umask(umask)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+	defer d.pool.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			d.shutdown()
+		case <-d.stop:
+		}
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-d.stop:
+				return nil
+			default:
+				return err
+			}
+		}
+		go d.serve(conn)
+	}
+}
+
+func (d *daemon) shutdown() {
+	d.stopOnce.Do(func() { close(d.stop) })
+}
+
+func (d *daemon) serve(conn net.Conn) {
+	sconn, chans, reqs, err := cssh.NewServerConn(conn, d.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+
+	var upstream *cssh.Client
+	for req := range reqs {
+		switch req.Type {
+		case daemonConnectRequest:
+			if upstream != nil {
+				_ = req.Reply(true, []byte("already connected"))
+				continue
+			}
+			client, err := d.connect(string(req.Payload))
+			if err != nil {
+				_ = req.Reply(true, []byte(err.Error()))
+				return
+			}
+			_ = req.Reply(true, nil)
+			upstream = client
+			defer d.pool.Put(upstream)
+			defer d.removeAgentTarget(upstream, sconn)
+			go d.relayChannels(upstream, sconn, chans)
+			go func() {
+				// the sessions cannot outlive the connection to the host
+				_ = upstream.Wait()
+				sconn.Close()
+			}()
+		case daemonVersionRequest:
+			if upstream == nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, upstream.ServerVersion())
+		case daemonStatusRequest:
+			status, _ := json.Marshal(DaemonStatus{
+				PID:         os.Getpid(),
+				Started:     d.started,
+				Connections: d.pool.Stats(),
+			})
+			_ = req.Reply(true, status)
+		case daemonStopRequest:
+			_ = req.Reply(true, nil)
+			d.shutdown()
+		case "keepalive@openssh.com":
+			_ = req.Reply(true, nil)
+		default:
+			_ = req.Reply(false, nil)
+		}
+	}
+}
+
+func (d *daemon) connect(host string) (*cssh.Client, error) {
+	configs, err := d.configs()
+	if err != nil {
+		return nil, fmt.Errorf("loading the configs: %w", err)
+	}
+	for _, cfg := range configs {
+		if cfg.Host == host {
+			// the agent of each client is forwarded instead, see forwardAgentOf
+			cfg.ForwardAgent = false
+			return d.pool.Get(cfg)
+		}
+	}
+	return nil, fmt.Errorf("host %s not found", host)
+}
+
+func (d *daemon) relayChannels(upstream *cssh.Client, sconn *cssh.ServerConn, chans <-chan cssh.NewChannel) {
+	for newChannel := range chans {
+		go relayChannel(upstream, newChannel, func(req *cssh.Request) {
+			if req.Type == agentRequestType {
+				d.forwardAgentOf(upstream, sconn)
+			}
+		})
+	}
+}
+
+// forwardAgentOf sends the agent requests of the host to the client
+// connection, which forwards them to its own agent.
+func (d *daemon) forwardAgentOf(upstream *cssh.Client, sconn *cssh.ServerConn) {
+	d.agentMu.Lock()
+	defer d.agentMu.Unlock()
+	targets, has := d.agentTargets[upstream]
+	for i := range targets {
+		if targets[i] == sconn {
+			targets = append(targets[:i], targets[i+1:]...)
+			break
+		}
+	}
+	d.agentTargets[upstream] = append(targets, sconn)
+	if has {
+		return
+	}
+	agentChannels := upstream.HandleChannelOpen(agentChannelType)
+	if agentChannels == nil { // already handled
+		return
+	}
+	go func() {
+		for newChannel := range agentChannels {
+			d.agentMu.Lock()
+			targets := d.agentTargets[upstream]
+			d.agentMu.Unlock()
+			if len(targets) == 0 {
+				_ = newChannel.Reject(cssh.Prohibited, "no agent forwarded")
+				continue
+			}
+			go relayChannel(targets[len(targets)-1], newChannel, nil)
+		}
+	}()
+}
+
+func (d *daemon) removeAgentTarget(upstream *cssh.Client, sconn *cssh.ServerConn) {
+	d.agentMu.Lock()
+	defer d.agentMu.Unlock()
+	targets := d.agentTargets[upstream]
+	for i := range targets {
+		if targets[i] == sconn {
+			targets = append(targets[:i], targets[i+1:]...)
+			break
+		}
+	}
+	if len(targets) == 0 {
+		delete(d.agentTargets, upstream)
+	} else {
+		d.agentTargets[upstream] = targets
+	}
+}
+
+// channelOpener is either side of an SSH connection.
+type channelOpener interface {
+	OpenChannel(name string, data []byte) (cssh.Channel, <-chan *cssh.Request, error)
+}
+
+// relayChannel opens the same channel on upstream and relays the data and
+// the requests, e.g. pty-req, exec or exit-status, both ways. onRequest, when
+// set, is called before a request of the client is relayed.
+func relayChannel(upstream channelOpener, newChannel cssh.NewChannel, onRequest func(req *cssh.Request)) {
+	up, upRequests, err := upstream.OpenChannel(newChannel.ChannelType(), newChannel.ExtraData())
+	if err != nil {
+		var openErr *cssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			_ = newChannel.Reject(openErr.Reason, openErr.Message)
+		} else {
+			_ = newChannel.Reject(cssh.ConnectionFailed, err.Error())
+		}
+		return
+	}
+	down, downRequests, err := newChannel.Accept()
+	if err != nil {
+		up.Close()
+		return
+	}
+
+	go func() {
+		forwardRequests(downRequests, up, onRequest)
+		up.Close() // closed by the client
+	}()
+	go func() {
+		_, _ = io.Copy(up, down)
+		_ = up.CloseWrite()
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(down, up)
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(down.Stderr(), up.Stderr())
+	}()
+	go func() {
+		defer wg.Done()
+		// exit-status comes last, before the host closes the channel
+		forwardRequests(upRequests, down, nil)
+	}()
+	wg.Wait()
+	_ = down.CloseWrite()
+	down.Close()
+}
+
+func forwardRequests(requests <-chan *cssh.Request, channel cssh.Channel, onRequest func(req *cssh.Request)) {
+	for req := range requests {
+		if onRequest != nil {
+			onRequest(req)
+		}
+		ok, err := channel.SendRequest(req.Type, req.WantReply, req.Payload)
+		if req.WantReply {
+			_ = req.Reply(ok && err == nil, nil)
+		}
+	}
+}
+
+// dialDaemon opens a connection to host through the daemon. ErrNoDaemon is
+// returned when the daemon could not be reached.
+func dialDaemon(socket, host string) (*cssh.Client, error) {
+	if socket == "" {
+		return nil, ErrNoDaemon
+	}
+	client, reply, err := daemonRequest(socket, daemonConnectRequest, []byte(host))
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 0 {
+		client.Close()
+		return nil, errors.New(string(reply))
+	}
+	// the version of the daemon is the one of the client, not of the host
+	if ok, version, err := client.SendRequest(daemonVersionRequest, true, nil); ok && err == nil {
+		serverVersions.Store(client, string(version))
+		go func() {
+			_ = client.Wait()
+			serverVersions.Delete(client)
+		}()
+	}
+	return client, nil
+}
+
+// DaemonStatusOf asks the daemon listening on socket for its status.
+func DaemonStatusOf(socket string) (DaemonStatus, error) {
+	var status DaemonStatus
+	client, reply, err := daemonRequest(socket, daemonStatusRequest, nil)
+	if err != nil {
+		return status, err
+	}
+	defer client.Close()
+	return status, json.Unmarshal(reply, &status)
+}
+
+// StopDaemon stops the daemon listening on socket, closing its connections.
+func StopDaemon(socket string) error {
+	client, _, err := daemonRequest(socket, daemonStopRequest, nil)
+	if err != nil {
+		return err
+	}
+	_ = client.Close() // already closed by the daemon exiting
+	return nil
+}
+
+// daemonRequest connects to the daemon and sends it a request.
+func daemonRequest(socket, request string, payload []byte) (*cssh.Client, []byte, error) {
+	conn, err := net.DialTimeout("unix", socket, sshTimeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrNoDaemon, err)
+	}
+	sconn, chans, reqs, err := cssh.NewClientConn(conn, socket, &cssh.ClientConfig{
+		User:            "s1h",
+		HostKeyCallback: cssh.InsecureIgnoreHostKey(), // the socket is only accessible to the user
+		Timeout:         sshTimeout,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("%w: %v", ErrNoDaemon, err)
+	}
+	client := cssh.NewClient(sconn, chans, reqs)
+	ok, reply, err := client.SendRequest(request, true, payload)
+	if err != nil || !ok {
+		client.Close()
+		return nil, nil, fmt.Errorf("%w: %s request refused", ErrNoDaemon, request)
+	}
+	return client, reply, nil
+}
@@ -0,0 +1,268 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/sftp"
+	cssh "golang.org/x/crypto/ssh"
+)
+
+var ErrFileUnchanged = errors.New("file unchanged")
+
+// RemoteChangedError is returned when the remote file was modified while it
+// was being edited locally. The local edits are kept in LocalCopy.
+type RemoteChangedError struct {
+	RemotePath string
+	LocalCopy  string
+	Diff       string
+}
+
+func (e *RemoteChangedError) Error() string {
+	return fmt.Sprintf("%s changed on the remote while editing, edits kept in %s",
+		e.RemotePath, e.LocalCopy)
+}
+
+// EditRemoteFile downloads remotePath to a private temp file, opens it in the
+// local $VISUAL/$EDITOR and uploads it back atomically once the editor exits.
+// The upload is refused if the remote file changed in the meantime.
+func EditRemoteFile(client *cssh.Client, remotePath string) error {
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+
+	info, original, err := readRemoteFile(sftpClient, remotePath)
+	if err != nil {
+		return err
+	}
+
+	localFile, err := os.CreateTemp("", "s1h-*-"+path.Base(remotePath))
+	if err != nil {
+		return fmt.Errorf("failed to create local file: %w", err)
+	}
+	localPath := localFile.Name()
+	_, err = localFile.Write(original)
+	localFile.Close()
+	if err != nil {
+		os.Remove(localPath)
+		return fmt.Errorf("failed to write local file: %w", err)
+	}
+
+	err = runEditor(localPath)
+	if err != nil {
+		os.Remove(localPath)
+		return err
+	}
+
+	edited, err := os.ReadFile(localPath)
+	if err != nil {
+		os.Remove(localPath)
+		return fmt.Errorf("failed to read local file: %w", err)
+	}
+	if bytes.Equal(edited, original) {
+		os.Remove(localPath)
+		return ErrFileUnchanged
+	}
+
+	currentInfo, current, err := readRemoteFile(sftpClient, remotePath)
+	if err != nil {
+		return fmt.Errorf("%w (edits kept in %s)", err, localPath)
+	}
+	if !currentInfo.ModTime().Equal(info.ModTime()) || !bytes.Equal(current, original) {
+		return &RemoteChangedError{
+			RemotePath: remotePath,
+			LocalCopy:  localPath,
+			Diff:       unifiedDiff(current, edited, "remote:"+remotePath, "local:"+localPath),
+		}
+	}
+
+	// a symlink is kept, the file it points to is replaced
+	target, resolveErr := resolveLinks(sftpClient, remotePath)
+	if resolveErr != nil || linkCount(client, target) > 1 {
+		// renaming would detach the file from its other links
+		err = overwrite(sftpClient, remotePath, edited)
+	} else {
+		err = atomicUpload(sftpClient, target, edited, currentInfo)
+		if errors.Is(err, errOwnerNotKept) {
+			// e.g. a root owned file edited with sudo rights only
+			err = overwrite(sftpClient, target, edited)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w (edits kept in %s)", err, localPath)
+	}
+	os.Remove(localPath)
+	return nil
+}
+
+func readRemoteFile(sftpClient *sftp.Client, remotePath string) (os.FileInfo, []byte, error) {
+	remoteFile, err := sftpClient.Open(remotePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open remote file: %w", err)
+	}
+	defer remoteFile.Close()
+
+	info, err := remoteFile.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat remote file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, nil, fmt.Errorf("%s is a directory", remotePath)
+	}
+	content, err := io.ReadAll(remoteFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read remote file: %w", err)
+	}
+	return info, content, nil
+}
+
+var errOwnerNotKept = errors.New("failed to keep the owner")
+
+// atomicUpload writes content next to remotePath and renames it over the
+// original so readers never observe a partially written file. The owner and
+// the mode of the original, setuid, setgid and sticky bits included, are
+// kept.
+func atomicUpload(sftpClient *sftp.Client, remotePath string, content []byte, info os.FileInfo) error {
+	// unique, not to clash with another edit of the same file
+	tmpPath := path.Join(path.Dir(remotePath),
+		fmt.Sprintf(".%s.s1h-%d-%d.tmp", path.Base(remotePath), os.Getpid(), rand.Uint32()))
+	tmpFile, err := sftpClient.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file %s: %w", tmpPath, err)
+	}
+	_, err = tmpFile.Write(content)
+	tmpFile.Close()
+	if err != nil {
+		sftpClient.Remove(tmpPath)
+		return fmt.Errorf("failed to copy file content: %w", err)
+	}
+	// chown first, it clears the setuid and setgid bits
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		err = sftpClient.Chown(tmpPath, int(stat.UID), int(stat.GID))
+		if err != nil {
+			sftpClient.Remove(tmpPath)
+			return fmt.Errorf("%w %d:%d: %w", errOwnerNotKept, stat.UID, stat.GID, err)
+		}
+	}
+	err = sftpClient.Chmod(tmpPath, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+	if err != nil {
+		sftpClient.Remove(tmpPath)
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	err = sftpClient.PosixRename(tmpPath, remotePath)
+	if err != nil {
+		sftpClient.Remove(tmpPath)
+		return fmt.Errorf("failed to replace %s: %w", remotePath, err)
+	}
+	return nil
+}
+
+// overwrite writes content over remotePath in place, keeping its owner, mode
+// and hard links at the cost of atomicity.
+func overwrite(sftpClient *sftp.Client, remotePath string, content []byte) error {
+	remoteFile, err := sftpClient.OpenFile(remotePath, os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to open remote file: %w", err)
+	}
+	_, err = remoteFile.Write(content)
+	if closeErr := remoteFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", remotePath, err)
+	}
+	return nil
+}
+
+// resolveLinks follows the symlinks of remotePath up to the file they point
+// to.
+func resolveLinks(sftpClient *sftp.Client, remotePath string) (string, error) {
+	for range 40 { // as ELOOP
+		info, err := sftpClient.Lstat(remotePath)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return remotePath, nil
+		}
+		dest, err := sftpClient.ReadLink(remotePath)
+		if err != nil {
+			return "", err
+		}
+		if !path.IsAbs(dest) {
+			dest = path.Join(path.Dir(remotePath), dest)
+		}
+		remotePath = dest
+	}
+	return "", fmt.Errorf("%s: too many levels of symbolic links", remotePath)
+}
+
+// linkCount returns the number of hard links of remotePath, which SFTP does
+// not report, 1 when it cannot be told.
+func linkCount(client *cssh.Client, remotePath string) int {
+	ctx, cancel := context.WithTimeout(context.Background(), sshTimeout)
+	defer cancel()
+	quoted := ShellQuote(remotePath)
+	res := RunCommand(ctx, client, "stat -c %h -- "+quoted+" 2>/dev/null || stat -f %l "+quoted)
+	n, err := strconv.Atoi(strings.TrimSpace(string(res.Stdout)))
+	if res.Failed() || err != nil {
+		return 1
+	}
+	return n
+}
+
+func runEditor(localPath string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], localPath)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("editor %s failed: %w", editor, err)
+	}
+	return nil
+}
+
+// unifiedDiff relies on the local diff tool, falling back to a notice when it
+// is not available.
+func unifiedDiff(a, b []byte, aLabel, bLabel string) string {
+	dir, err := os.MkdirTemp("", "s1h-diff-")
+	if err != nil {
+		return err.Error()
+	}
+	defer os.RemoveAll(dir)
+
+	aPath, bPath := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	if err := os.WriteFile(aPath, a, 0600); err != nil {
+		return err.Error()
+	}
+	if err := os.WriteFile(bPath, b, 0600); err != nil {
+		return err.Error()
+	}
+	out, err := exec.Command("diff", "-u", "--label", aLabel, "--label", bLabel, aPath, bPath).Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return fmt.Sprintf("diff unavailable: %v", err)
+	}
+	return string(out)
+}
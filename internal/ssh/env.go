@@ -0,0 +1,131 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	cssh "golang.org/x/crypto/ssh"
+)
+
+// EnvVar is an environment variable set on the remote side.
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+// ParseEnvVar parses a NAME=VALUE assignment.
+func ParseEnvVar(text string) (EnvVar, error) {
+	name, value, found := strings.Cut(text, "=")
+	if !found || name == "" {
+		return EnvVar{}, fmt.Errorf("bad environment variable %q, expected NAME=VALUE", text)
+	}
+	return EnvVar{Name: name, Value: value}, nil
+}
+
+// Environment returns the variables sent to the host: the local variables
+// matching SendEnv, overridden by SetEnv.
+func (c SSHConfig) Environment() []EnvVar {
+	var vars []EnvVar
+	index := map[string]int{}
+	set := func(v EnvVar) {
+		if i, has := index[v.Name]; has {
+			vars[i] = v
+			return
+		}
+		index[v.Name] = len(vars)
+		vars = append(vars, v)
+	}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		for _, pattern := range c.SendEnv {
+			if matched, _ := path.Match(pattern, name); matched {
+				set(EnvVar{Name: name, Value: value})
+				break
+			}
+		}
+	}
+	for _, v := range c.SetEnv {
+		set(v)
+	}
+	return vars
+}
+
+// splitQuoted splits an option value on spaces, double quotes group words.
+func splitQuoted(value string) []string {
+	var words []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	for _, r := range value {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case (r == ' ' || r == '\t') && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// clientEnv is the environment sent by the sessions of a client.
+type clientEnv struct {
+	host     string
+	vars     []EnvVar
+	reported sync.Once
+}
+
+var (
+	clientEnvs         sync.Map // *cssh.Client -> *clientEnv
+	envRejectedHandler func(host string, names []string)
+)
+
+// SetEnvRejectedHandler registers f to be called, once per connection and
+// from the goroutine opening the session, with the variables the host
+// refused. sshd only accepts the variables listed in its AcceptEnv.
+func SetEnvRejectedHandler(f func(host string, names []string)) {
+	envRejectedHandler = f
+}
+
+func setClientEnv(client *cssh.Client, host string, vars []EnvVar) {
+	if len(vars) == 0 {
+		return
+	}
+	clientEnvs.Store(client, &clientEnv{host: host, vars: vars})
+	go func() {
+		_ = client.Wait()
+		clientEnvs.Delete(client)
+	}()
+}
+
+// sendEnv sets the environment of the client on the session.
+func sendEnv(client *cssh.Client, session *cssh.Session) {
+	value, has := clientEnvs.Load(client)
+	if !has {
+		return
+	}
+	env := value.(*clientEnv)
+	var rejected []string
+	for _, v := range env.vars {
+		if session.Setenv(v.Name, v.Value) != nil {
+			rejected = append(rejected, v.Name)
+		}
+	}
+	if len(rejected) != 0 && envRejectedHandler != nil {
+		env.reported.Do(func() {
+			envRejectedHandler(env.host, rejected)
+		})
+	}
+}
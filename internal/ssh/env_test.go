@@ -0,0 +1,101 @@
+package ssh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitQuoted(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"empty", "", nil},
+		{"blank", "  \t ", nil},
+		{"one", "LANG", []string{"LANG"}},
+		{"words", "LANG LC_*  \tTZ", []string{"LANG", "LC_*", "TZ"}},
+		{"quoted spaces", `FOO="a b" BAR=c`, []string{"FOO=a b", "BAR=c"}},
+		{"quoted word", `"LANG" TZ`, []string{"LANG", "TZ"}},
+		{"empty quotes", `FOO="" BAR`, []string{"FOO=", "BAR"}},
+		{"only quotes", `""`, []string{""}},
+		{"unterminated quote", `FOO="a b`, []string{"FOO=a b"}},
+		{"trailing spaces", "LANG ", []string{"LANG"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitQuoted(tt.value)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitQuoted(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEnvVar(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    EnvVar
+		wantErr bool
+	}{
+		{text: "FOO=bar", want: EnvVar{Name: "FOO", Value: "bar"}},
+		{text: "FOO=", want: EnvVar{Name: "FOO"}},
+		{text: "FOO=a=b", want: EnvVar{Name: "FOO", Value: "a=b"}},
+		{text: "FOO", wantErr: true},
+		{text: "=bar", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := ParseEnvVar(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEnvVar(%q) error = %v, want error %t", tt.text, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseEnvVar(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	t.Setenv("S1H_TEST_LANG", "fr_FR.UTF-8")
+	t.Setenv("S1H_TEST_TZ", "UTC")
+	tests := []struct {
+		name string
+		cfg  SSHConfig
+		want []EnvVar
+	}{
+		{"none", SSHConfig{}, nil},
+		{
+			"send",
+			SSHConfig{SendEnv: []string{"S1H_TEST_TZ"}},
+			[]EnvVar{{Name: "S1H_TEST_TZ", Value: "UTC"}},
+		},
+		{
+			"set overrides send",
+			SSHConfig{
+				SendEnv: []string{"S1H_TEST_TZ"},
+				SetEnv:  []EnvVar{{Name: "S1H_TEST_TZ", Value: "Asia/Tokyo"}},
+			},
+			[]EnvVar{{Name: "S1H_TEST_TZ", Value: "Asia/Tokyo"}},
+		},
+		{
+			"pattern",
+			SSHConfig{SendEnv: []string{"S1H_TEST_T*"}},
+			[]EnvVar{{Name: "S1H_TEST_TZ", Value: "UTC"}},
+		},
+		{
+			"unset variables are not sent",
+			SSHConfig{SendEnv: []string{"S1H_TEST_UNSET"}},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.cfg.Environment()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Environment() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
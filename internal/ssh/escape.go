@@ -0,0 +1,238 @@
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"syscall"
+
+	cssh "golang.org/x/crypto/ssh"
+)
+
+const defaultEscapeChar = '~'
+
+// ParseEscapeChar parses the EscapeChar option: a single character, a control
+// character written "^X" or "none" to disable escapes. It defaults to ~.
+func ParseEscapeChar(value string) (escape byte, enabled bool, err error) {
+	switch {
+	case value == "":
+		return defaultEscapeChar, true, nil
+	case strings.EqualFold(value, "none"):
+		return 0, false, nil
+	case len(value) == 1:
+		return value[0], true, nil
+	case len(value) == 2 && value[0] == '^':
+		return value[1] & 0x1f, true, nil
+	}
+	return defaultEscapeChar, true, fmt.Errorf("bad EscapeChar %q", value)
+}
+
+// escapeName displays the escape character, control characters as ^X.
+func escapeName(escape byte) string {
+	if escape < 0x20 {
+		return "^" + string(rune(escape+'@'))
+	}
+	return string(rune(escape))
+}
+
+// escapeReader filters the keystrokes of an interactive session for OpenSSH
+// style escape sequences, recognized right after a newline:
+// ~. disconnects, ~^Z suspends, ~# lists the forwards, ~C opens a command
+// line to add or cancel forwards and ~? prints the help.
+type escapeReader struct {
+	in     io.Reader
+	out    io.Writer // the local terminal, in raw mode
+	escape byte
+	client *cssh.Client
+
+	// disconnect closes the session, raw and cooked switch the local
+	// terminal mode.
+	disconnect func()
+	raw        func()
+	cooked     func()
+
+	lineStart bool
+	escaped   bool
+	pending   []byte
+	buf       []byte
+	forwards  []*PortForward
+	closed    bool
+}
+
+func newEscapeReader(in io.Reader, out io.Writer, escape byte, client *cssh.Client,
+	disconnect, raw, cooked func()) *escapeReader {
+	return &escapeReader{
+		in:         in,
+		out:        out,
+		escape:     escape,
+		client:     client,
+		disconnect: disconnect,
+		raw:        raw,
+		cooked:     cooked,
+		lineStart:  true,
+	}
+}
+
+func (r *escapeReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.closed {
+			return 0, io.EOF
+		}
+		if cap(r.buf) < len(p) {
+			r.buf = make([]byte, len(p))
+		}
+		n, err := r.in.Read(r.buf[:len(p)])
+		r.filter(r.buf[:n])
+		if err != nil && len(r.pending) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *escapeReader) filter(in []byte) {
+	for _, b := range in {
+		if r.closed {
+			return
+		}
+		if r.escaped {
+			r.escaped = false
+			if r.command(b) {
+				r.lineStart = true
+				continue
+			}
+			if b != r.escape {
+				r.pending = append(r.pending, r.escape)
+			}
+		} else if r.lineStart && b == r.escape {
+			r.escaped = true
+			continue
+		}
+		r.pending = append(r.pending, b)
+		r.lineStart = b == '\r' || b == '\n'
+	}
+}
+
+// command runs the escape sequence ending with b, it reports whether b was a
+// command.
+func (r *escapeReader) command(b byte) bool {
+	switch b {
+	case '.':
+		r.printf("%s.\r\n", escapeName(r.escape))
+		r.closed = true
+		r.closeForwards()
+		r.disconnect()
+	case 0x1a: // ^Z
+		r.printf("%s^Z [suspend s1h]\r\n", escapeName(r.escape))
+		r.cooked()
+		_ = syscall.Kill(syscall.Getpid(), syscall.SIGTSTP)
+		r.raw()
+	case '?':
+		r.help()
+	case '#':
+		r.printf("%s#\r\nThe following connections are open:\r\n", escapeName(r.escape))
+		for _, f := range r.forwards {
+			r.printf("  %s\r\n", f)
+		}
+	case 'C':
+		r.commandLine()
+	default:
+		return false
+	}
+	return true
+}
+
+func (r *escapeReader) help() {
+	e := escapeName(r.escape)
+	r.printf("%s?\r\nSupported escape sequences:\r\n", e)
+	for _, line := range [][2]string{
+		{".", "terminate connection"},
+		{"C", "open a command line"},
+		{"#", "list forwarded connections"},
+		{"^Z", "suspend s1h"},
+		{"?", "this message"},
+		{e, "send the escape character by typing it twice"},
+	} {
+		r.printf(" %s%-3s - %s\r\n", e, line[0], line[1])
+	}
+	r.printf("(Note that escapes are only recognized immediately after newline.)\r\n")
+}
+
+// commandLine reads an ssh> command adding (-L, -R) or cancelling (-KL, -KR)
+// a port forward.
+func (r *escapeReader) commandLine() {
+	r.cooked()
+	defer r.raw()
+	r.printf("\r\nssh> ")
+	line, err := bufio.NewReader(oneByteReader{r.in}).ReadString('\n')
+	if err != nil {
+		return
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+	if len(fields) != 2 {
+		r.printf("Usage: -L|-R [bind_address:]port:host:hostport, -KL|-KR [bind_address:]port\n")
+		return
+	}
+	switch fields[0] {
+	case "-L", "-R":
+		bind, target, err := ParseForwardSpec(fields[1])
+		if err != nil {
+			r.printf("%v\n", err)
+			return
+		}
+		f, err := StartPortForward(r.client, fields[0][1:], bind, target)
+		if err != nil {
+			r.printf("%v\n", err)
+			return
+		}
+		r.forwards = append(r.forwards, f)
+		r.printf("Forwarding port.\n")
+	case "-KL", "-KR":
+		bind, err := ParseBindSpec(fields[1])
+		if err != nil {
+			r.printf("%v\n", err)
+			return
+		}
+		for i, f := range r.forwards {
+			if f.Kind == fields[0][2:] && f.Bind == bind {
+				_ = f.Close()
+				r.forwards = append(r.forwards[:i], r.forwards[i+1:]...)
+				r.printf("Canceled forwarding.\n")
+				return
+			}
+		}
+		r.printf("Unknown port forwarding.\n")
+	default:
+		r.printf("Invalid command.\n")
+	}
+}
+
+func (r *escapeReader) closeForwards() {
+	for _, f := range r.forwards {
+		_ = f.Close()
+	}
+	r.forwards = nil
+}
+
+func (r *escapeReader) printf(format string, args ...any) {
+	fmt.Fprintf(r.out, format, args...)
+}
+
+// oneByteReader reads a byte at a time, not to consume what follows the
+// command line.
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (o oneByteReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return o.r.Read(p)
+}
@@ -0,0 +1,79 @@
+package ssh
+
+import (
+	"io"
+	"testing"
+)
+
+func TestParseEscapeChar(t *testing.T) {
+	tests := []struct {
+		value       string
+		wantEscape  byte
+		wantEnabled bool
+		wantErr     bool
+	}{
+		{value: "", wantEscape: '~', wantEnabled: true},
+		{value: "none", wantEnabled: false},
+		{value: "NONE", wantEnabled: false},
+		{value: "%", wantEscape: '%', wantEnabled: true},
+		{value: "^]", wantEscape: 0x1d, wantEnabled: true},
+		{value: "^a", wantEscape: 0x01, wantEnabled: true},
+		{value: "ab", wantEscape: '~', wantEnabled: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			escape, enabled, err := ParseEscapeChar(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEscapeChar(%q) error = %v, want error %t", tt.value, err, tt.wantErr)
+			}
+			if enabled != tt.wantEnabled || (enabled && escape != tt.wantEscape) {
+				t.Errorf("ParseEscapeChar(%q) = %q, %t, want %q, %t",
+					tt.value, escape, enabled, tt.wantEscape, tt.wantEnabled)
+			}
+		})
+	}
+}
+
+func TestEscapeReaderFilter(t *testing.T) {
+	tests := []struct {
+		name           string
+		chunks         []string
+		escape         byte
+		want           string
+		wantDisconnect bool
+	}{
+		{name: "plain", chunks: []string{"ls -l\r"}, want: "ls -l\r"},
+		{name: "disconnect", chunks: []string{"~."}, want: "", wantDisconnect: true},
+		{name: "disconnect after return", chunks: []string{"ls\r~."}, want: "ls\r", wantDisconnect: true},
+		{name: "disconnect after newline", chunks: []string{"ls\n~."}, want: "ls\n", wantDisconnect: true},
+		{name: "not after a newline", chunks: []string{"echo ~."}, want: "echo ~."},
+		{name: "not at the start of a word", chunks: []string{"a~.\r"}, want: "a~.\r"},
+		{name: "split across reads", chunks: []string{"\r~", "."}, want: "\r", wantDisconnect: true},
+		{name: "escape sent once when doubled", chunks: []string{"~~/x"}, want: "~/x"},
+		{name: "unknown sequence kept", chunks: []string{"~/tmp"}, want: "~/tmp"},
+		{name: "help swallowed", chunks: []string{"~?ls"}, want: "ls"},
+		{name: "command then escape", chunks: []string{"~#~."}, want: "", wantDisconnect: true},
+		{name: "nothing after disconnect", chunks: []string{"~.ls\r"}, want: "", wantDisconnect: true},
+		{name: "other escape char", chunks: []string{"~.", "\r%."}, escape: '%', want: "~.\r", wantDisconnect: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			escape := tt.escape
+			if escape == 0 {
+				escape = defaultEscapeChar
+			}
+			disconnected := false
+			r := newEscapeReader(nil, io.Discard, escape, nil,
+				func() { disconnected = true }, func() {}, func() {})
+			for _, chunk := range tt.chunks {
+				r.filter([]byte(chunk))
+			}
+			if got := string(r.pending); got != tt.want {
+				t.Errorf("filter(%q) sent %q, want %q", tt.chunks, got, tt.want)
+			}
+			if disconnected != tt.wantDisconnect {
+				t.Errorf("filter(%q) disconnected = %t, want %t", tt.chunks, disconnected, tt.wantDisconnect)
+			}
+		})
+	}
+}
@@ -0,0 +1,352 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	cssh "golang.org/x/crypto/ssh"
+)
+
+// StreamCommand runs command on the remote host, fed with stdin when not nil,
+// and calls onLine for every line printed on stdout or stderr, one call at a
+// time. Cancelling ctx interrupts the command and closes the session.
+func StreamCommand(ctx context.Context, client *cssh.Client, command string, stdin io.Reader,
+	onLine func(line string, stderr bool)) (int, error) {
+	sess, err := newSession(client)
+	if err != nil {
+		return -1, err
+	}
+	defer sess.Close()
+	sess.Stdin = stdin
+
+	stdout, err := sess.StdoutPipe()
+	if err != nil {
+		return -1, err
+	}
+	stderr, err := sess.StderrPipe()
+	if err != nil {
+		return -1, err
+	}
+	err = sess.Start(command)
+	if err != nil {
+		return -1, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = sess.Signal(cssh.SIGTERM)
+			_ = sess.Close()
+		case <-done:
+		}
+	}()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	scan := func(r io.Reader, isStderr bool) {
+		defer wg.Done()
+		// lines longer than the buffer are passed in chunks, reading on
+		// until EOF keeps the command from blocking on a full pipe
+		reader := bufio.NewReaderSize(r, 64*1024)
+		for {
+			line, _, err := reader.ReadLine()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			onLine(string(line), isStderr)
+			mu.Unlock()
+		}
+	}
+	wg.Add(2)
+	go scan(stdout, false)
+	go scan(stderr, true)
+	wg.Wait()
+
+	err = sess.Wait()
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+	code, err := exitStatus(err)
+	if lost := ConnectionLost(client); err != nil && lost != nil {
+		err = lost
+	}
+	return code, err
+}
+
+// ExecResult is the outcome of a command run on a single host.
+type ExecResult struct {
+	Host     string
+	ExitCode int
+	Stdout   []byte
+	Stderr   []byte
+	Duration time.Duration
+	Err      error
+	TimedOut bool
+}
+
+func (r ExecResult) Failed() bool {
+	return r.Err != nil || r.ExitCode != 0
+}
+
+const DefaultParallelism = 10
+
+// MultiExecOptions controls how a command is fanned out across hosts. Zero
+// values mean no limit.
+type MultiExecOptions struct {
+	Parallelism int
+	Timeout     time.Duration // per host
+	Deadline    time.Duration // whole run
+	// OnLine, when set, receives every output line as it is printed, one
+	// call at a time across all hosts.
+	OnLine func(host, line string, stderr bool)
+	// Stdin, when set, is fed to the command on every host.
+	Stdin []byte
+	// Sudo runs the command through sudo with the password of each host.
+	Sudo          bool
+	SudoPasswords map[string]string
+}
+
+// ExecOnMany runs command concurrently on every client, honoring the
+// parallelism limit and timeouts of opts. onResult, when set, is called as
+// soon as a host completes.
+func ExecOnMany(ctx context.Context, hosts []string, clients []*cssh.Client, command string,
+	opts MultiExecOptions, onResult func(i int, res ExecResult)) []ExecResult {
+	return execEach(ctx, hosts, command, opts, onResult, func(i int) (*cssh.Client, func(), error) {
+		return clients[i], func() {}, nil
+	})
+}
+
+// DialAndExecOnMany is ExecOnMany connecting to each host only once its turn
+// comes, so the parallelism limit also bounds the connections, and closing
+// the connection after. A host which cannot be reached reports
+// ErrConnectionFailed wrapping the reason.
+func DialAndExecOnMany(ctx context.Context, configs []SSHConfig, command string,
+	opts MultiExecOptions, onResult func(i int, res ExecResult)) []ExecResult {
+	hosts := make([]string, len(configs))
+	for i := range configs {
+		hosts[i] = configs[i].Host
+	}
+	return execEach(ctx, hosts, command, opts, onResult, func(i int) (*cssh.Client, func(), error) {
+		client, err := SSHClient(configs[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrConnectionFailed, err)
+		}
+		return client, func() { client.Close() }, nil
+	})
+}
+
+// ExecOnMany is DialAndExecOnMany getting the connections from the pool and
+// handing them back after.
+func (p *Pool) ExecOnMany(ctx context.Context, configs []SSHConfig, command string,
+	opts MultiExecOptions, onResult func(i int, res ExecResult)) []ExecResult {
+	hosts := make([]string, len(configs))
+	for i := range configs {
+		hosts[i] = configs[i].Host
+	}
+	return execEach(ctx, hosts, command, opts, onResult, func(i int) (*cssh.Client, func(), error) {
+		client, err := p.Get(configs[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrConnectionFailed, err)
+		}
+		return client, func() { p.Put(client) }, nil
+	})
+}
+
+// execEach runs command on every host, connect providing the client of a host
+// and the function releasing it.
+func execEach(ctx context.Context, hosts []string, command string, opts MultiExecOptions,
+	onResult func(i int, res ExecResult), connect func(i int) (*cssh.Client, func(), error)) []ExecResult {
+	if opts.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Deadline)
+		defer cancel()
+	}
+	parallelism := opts.Parallelism
+	if parallelism <= 0 || parallelism > len(hosts) {
+		parallelism = len(hosts)
+	}
+
+	results := make([]ExecResult, len(hosts))
+	sem := make(chan struct{}, parallelism)
+	var lineMu sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(len(hosts))
+	for i := range hosts {
+		go func(i int) {
+			defer wg.Done()
+			defer func() {
+				if onResult != nil {
+					onResult(i, results[i])
+				}
+			}()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil { // never started
+				results[i] = ExecResult{
+					Host:     hosts[i],
+					ExitCode: -1,
+					Err:      ctx.Err(),
+					TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+				}
+				return
+			}
+			client, release, err := connect(i)
+			if err != nil {
+				results[i] = ExecResult{Host: hosts[i], ExitCode: -1, Err: err}
+				return
+			}
+			defer release()
+
+			hostCommand, stdin := command, opts.Stdin
+			if opts.Sudo {
+				hostCommand = SudoCommand(command)
+				stdin = SudoStdin(opts.SudoPasswords[hosts[i]], opts.Stdin)
+			}
+
+			hostCtx := ctx
+			if opts.Timeout > 0 {
+				var cancel context.CancelFunc
+				hostCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+				defer cancel()
+			}
+			if opts.OnLine != nil {
+				stdout := &lineWriter{onLine: func(line string) {
+					lineMu.Lock()
+					defer lineMu.Unlock()
+					opts.OnLine(hosts[i], line, false)
+				}}
+				stderr := &lineWriter{onLine: func(line string) {
+					lineMu.Lock()
+					defer lineMu.Unlock()
+					opts.OnLine(hosts[i], line, true)
+				}}
+				results[i] = runCommand(hostCtx, client, hostCommand, stdin, stdout, stderr)
+				stdout.Flush()
+				stderr.Flush()
+			} else {
+				results[i] = runCommand(hostCtx, client, hostCommand, stdin, nil, nil)
+			}
+			results[i].Host = hosts[i]
+			results[i].TimedOut = errors.Is(results[i].Err, context.DeadlineExceeded)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// RunCommand runs command on the remote host and collects stdout and stderr
+// separately. Cancelling ctx interrupts the command.
+func RunCommand(ctx context.Context, client *cssh.Client, command string) ExecResult {
+	return runCommand(ctx, client, command, nil, nil, nil)
+}
+
+// runCommand is RunCommand feeding stdin to the command and additionally
+// copying the output to the given writers when they are not nil.
+func runCommand(ctx context.Context, client *cssh.Client, command string, stdin []byte,
+	stdoutCopy, stderrCopy io.Writer) (res ExecResult) {
+	start := time.Now()
+	defer func() {
+		res.Duration = time.Since(start)
+	}()
+
+	sess, err := newSession(client)
+	if err != nil {
+		res.ExitCode, res.Err = -1, err
+		return res
+	}
+	defer sess.Close()
+
+	var stdout, stderr bytes.Buffer
+	sess.Stdout = &stdout
+	sess.Stderr = &stderr
+	if stdoutCopy != nil {
+		sess.Stdout = io.MultiWriter(&stdout, stdoutCopy)
+	}
+	if stderrCopy != nil {
+		sess.Stderr = io.MultiWriter(&stderr, stderrCopy)
+	}
+	if stdin != nil {
+		sess.Stdin = bytes.NewReader(stdin)
+	}
+	err = sess.Start(command)
+	if err != nil {
+		res.ExitCode, res.Err = -1, err
+		return res
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = sess.Signal(cssh.SIGTERM)
+			_ = sess.Close()
+		case <-done:
+		}
+	}()
+
+	err = sess.Wait()
+	res.Stdout, res.Stderr = stdout.Bytes(), stderr.Bytes()
+	if ctx.Err() != nil {
+		res.ExitCode, res.Err = -1, ctx.Err()
+		return res
+	}
+	res.ExitCode, res.Err = exitStatus(err)
+	if lost := ConnectionLost(client); res.Err != nil && lost != nil {
+		res.Err = lost
+	}
+	return res
+}
+
+// lineWriter calls onLine for every complete line written to it.
+type lineWriter struct {
+	buf    []byte
+	onLine func(line string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		n := bytes.IndexByte(w.buf, '\n')
+		if n == -1 {
+			break
+		}
+		w.onLine(string(w.buf[:n]))
+		w.buf = w.buf[n+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits the last line when it is not newline terminated.
+func (w *lineWriter) Flush() {
+	if len(w.buf) != 0 {
+		w.onLine(string(w.buf))
+		w.buf = nil
+	}
+}
+
+// exitStatus splits a session error into the remote exit code and a
+// transport error.
+func exitStatus(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *cssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	return -1, err
+}
@@ -0,0 +1,237 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cssh "golang.org/x/crypto/ssh"
+)
+
+// HostFacts describes the system of a host, as gathered by GatherFacts.
+// Sizes are in bytes.
+type HostFacts struct {
+	Host          string    `json:"host"`
+	OS            string    `json:"os"`
+	Distro        string    `json:"distro"`
+	DistroVersion string    `json:"distro_version"`
+	Kernel        string    `json:"kernel"`
+	Arch          string    `json:"arch"`
+	UptimeSec     int64     `json:"uptime_sec"`
+	CPUs          int       `json:"cpus"`
+	MemTotal      uint64    `json:"mem_total_bytes"`
+	MemAvailable  uint64    `json:"mem_available_bytes"`
+	DiskTotal     uint64    `json:"disk_total_bytes"` // of /
+	DiskUsed      uint64    `json:"disk_used_bytes"`
+	SSHServer     string    `json:"ssh_server"`
+	Collected     time.Time `json:"collected"`
+}
+
+// factsCommand prints the facts as key=value lines in one round trip. It
+// sticks to POSIX sh and the tools found on any Linux, the fields a system
+// lacks are left empty.
+const factsCommand = `(
+	if [ -r /etc/os-release ]; then . /etc/os-release; fi
+	echo "os=${PRETTY_NAME:-$(uname -s)}"
+	echo "distro=$ID"
+	echo "distro_version=$VERSION_ID"
+	echo "kernel=$(uname -r)"
+	echo "arch=$(uname -m)"
+	if [ -r /proc/uptime ]; then echo "uptime=$(cut -d' ' -f1 /proc/uptime)"; fi
+	echo "cpus=$(getconf _NPROCESSORS_ONLN 2>/dev/null || nproc 2>/dev/null)"
+	if [ -r /proc/meminfo ]; then
+		awk '/^MemTotal:/ {print "mem_total_kb=" $2} /^MemAvailable:/ {print "mem_available_kb=" $2}' /proc/meminfo
+	fi
+	df -Pk / 2>/dev/null | awk 'NR == 2 {print "disk_total_kb=" $2; print "disk_used_kb=" $3}'
+) 2>/dev/null`
+
+// GatherFacts collects the facts of the host of client.
+func GatherFacts(ctx context.Context, client *cssh.Client, host string) (HostFacts, error) {
+	res := RunCommand(ctx, client, factsCommand)
+	if res.Err != nil {
+		return HostFacts{}, res.Err
+	}
+	if res.ExitCode != 0 {
+		return HostFacts{}, fmt.Errorf("gathering facts failed with exit code %d: %s",
+			res.ExitCode, strings.TrimSpace(string(res.Stderr)))
+	}
+	facts := parseFacts(res.Stdout)
+	facts.Host = host
+	facts.SSHServer = ServerVersion(client)
+	facts.Collected = time.Now()
+	return facts, nil
+}
+
+func parseFacts(output []byte) HostFacts {
+	var facts HostFacts
+	kb := func(value string) uint64 {
+		n, _ := strconv.ParseUint(value, 10, 64)
+		return n * 1024
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "os":
+			facts.OS = value
+		case "distro":
+			facts.Distro = value
+		case "distro_version":
+			facts.DistroVersion = value
+		case "kernel":
+			facts.Kernel = value
+		case "arch":
+			facts.Arch = value
+		case "uptime":
+			seconds, _ := strconv.ParseFloat(value, 64)
+			facts.UptimeSec = int64(seconds)
+		case "cpus":
+			facts.CPUs, _ = strconv.Atoi(value)
+		case "mem_total_kb":
+			facts.MemTotal = kb(value)
+		case "mem_available_kb":
+			facts.MemAvailable = kb(value)
+		case "disk_total_kb":
+			facts.DiskTotal = kb(value)
+		case "disk_used_kb":
+			facts.DiskUsed = kb(value)
+		}
+	}
+	return facts
+}
+
+// Summary lists the facts as label and value pairs, skipping the unknown
+// ones.
+func (f HostFacts) Summary() [][2]string {
+	var fields [][2]string
+	add := func(label, value string) {
+		if value != "" {
+			fields = append(fields, [2]string{label, value})
+		}
+	}
+	add("OS", f.OS)
+	add("Kernel", f.Kernel)
+	add("Arch", f.Arch)
+	if f.UptimeSec > 0 {
+		add("Uptime", FormatUptime(time.Duration(f.UptimeSec)*time.Second))
+	}
+	if f.CPUs > 0 {
+		add("CPUs", strconv.Itoa(f.CPUs))
+	}
+	if f.MemTotal > 0 {
+		add("Memory", fmt.Sprintf("%s available of %s",
+			FormatBytes(f.MemAvailable), FormatBytes(f.MemTotal)))
+	}
+	if f.DiskTotal > 0 {
+		add("Disk /", fmt.Sprintf("%s used of %s (%d%%)",
+			FormatBytes(f.DiskUsed), FormatBytes(f.DiskTotal), f.DiskUsed*100/f.DiskTotal))
+	}
+	add("SSH server", f.SSHServer)
+	return fields
+}
+
+// FormatUptime formats d in days, hours and minutes, e.g. 3d 4h 12m.
+func FormatUptime(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	}
+	if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// FormatBytes formats n with a binary unit, e.g. 7.8G.
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+var (
+	factsMu    sync.Mutex
+	factsPath  string
+	factsCache map[string]HostFacts
+)
+
+// LoadFacts reads the facts cache file, a JSON object mapping a host to its
+// facts. A missing file means no facts.
+func LoadFacts(path string) error {
+	factsMu.Lock()
+	defer factsMu.Unlock()
+	factsPath = path
+	factsCache = map[string]HostFacts{}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(b, &factsCache)
+	if err != nil {
+		return fmt.Errorf("facts file broken: %w", err)
+	}
+	return nil
+}
+
+// CachedFacts returns the last facts gathered on host.
+func CachedFacts(host string) (HostFacts, bool) {
+	factsMu.Lock()
+	defer factsMu.Unlock()
+	facts, has := factsCache[host]
+	return facts, has
+}
+
+// StoreFacts caches facts and writes the cache file.
+func StoreFacts(facts HostFacts) error {
+	factsMu.Lock()
+	defer factsMu.Unlock()
+	if factsCache == nil {
+		factsCache = map[string]HostFacts{}
+	}
+	factsCache[facts.Host] = facts
+	if factsPath == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(factsCache, "", "  ")
+	if err != nil {
+		return err
+	}
+	// written aside then renamed, not to leave a truncated file behind
+	tmp, err := os.CreateTemp(filepath.Dir(factsPath), ".facts-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), factsPath)
+}
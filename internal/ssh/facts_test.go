@@ -0,0 +1,111 @@
+package ssh
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFacts(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   HostFacts
+	}{
+		{name: "empty", output: "", want: HostFacts{}},
+		{
+			name: "linux",
+			output: "os=Ubuntu 22.04.4 LTS\n" +
+				"distro=ubuntu\n" +
+				"distro_version=22.04\n" +
+				"kernel=5.15.0-105-generic\n" +
+				"arch=x86_64\n" +
+				"uptime=266523.17\n" +
+				"cpus=4\n" +
+				"mem_total_kb=8026156\n" +
+				"mem_available_kb=5864220\n" +
+				"disk_total_kb=81106868\n" +
+				"disk_used_kb=23311076\n",
+			want: HostFacts{
+				OS:            "Ubuntu 22.04.4 LTS",
+				Distro:        "ubuntu",
+				DistroVersion: "22.04",
+				Kernel:        "5.15.0-105-generic",
+				Arch:          "x86_64",
+				UptimeSec:     266523,
+				CPUs:          4,
+				MemTotal:      8026156 * 1024,
+				MemAvailable:  5864220 * 1024,
+				DiskTotal:     81106868 * 1024,
+				DiskUsed:      23311076 * 1024,
+			},
+		},
+		{
+			name:   "no os-release nor /proc",
+			output: "os=Darwin\ndistro=\ndistro_version=\nkernel=23.4.0\narch=arm64\ncpus=8\n",
+			want:   HostFacts{OS: "Darwin", Kernel: "23.4.0", Arch: "arm64", CPUs: 8},
+		},
+		{
+			name:   "value with equal signs and spaces",
+			output: "os= Debian GNU/Linux 12 (bookworm) \nkernel=6.1.0=custom\n",
+			want:   HostFacts{OS: "Debian GNU/Linux 12 (bookworm)", Kernel: "6.1.0=custom"},
+		},
+		{
+			name:   "garbage ignored",
+			output: "motd banner\nunknown=1\ncpus=two\narch=aarch64\n",
+			want:   HostFacts{Arch: "aarch64"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseFacts([]byte(tt.output))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFacts() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatUptime(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0m"},
+		{59 * time.Second, "0m"},
+		{42 * time.Minute, "42m"},
+		{5*time.Hour + 3*time.Minute, "5h 3m"},
+		{3*24*time.Hour + 4*time.Hour + 12*time.Minute, "3d 4h 12m"},
+		{24 * time.Hour, "1d 0h 0m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got := FormatUptime(tt.d)
+			if got != tt.want {
+				t.Errorf("FormatUptime(%s) = %q, want %q", tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.0K"},
+		{1536, "1.5K"},
+		{8026156 * 1024, "7.7G"},
+		{3 << 40, "3.0T"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got := FormatBytes(tt.n)
+			if got != tt.want {
+				t.Errorf("FormatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	cssh "golang.org/x/crypto/ssh"
+)
+
+// PortForward relays the connections accepted on a listening address to a
+// target address: -L listens locally and dials through the SSH connection,
+// -R listens on the remote host and dials locally.
+type PortForward struct {
+	Kind     string // "L" or "R"
+	Bind     string
+	Target   string
+	listener net.Listener
+}
+
+func (f *PortForward) String() string {
+	return fmt.Sprintf("-%s %s:%s", f.Kind, f.Bind, f.Target)
+}
+
+func (f *PortForward) Close() error {
+	return f.listener.Close()
+}
+
+// StartPortForward listens on bind and relays every connection to target.
+// kind is "L" for a local forward and "R" for a remote one.
+func StartPortForward(client *cssh.Client, kind, bind, target string) (*PortForward, error) {
+	f := &PortForward{Kind: kind, Bind: bind, Target: target}
+	var err error
+	var dial func() (net.Conn, error)
+	switch kind {
+	case "L":
+		f.listener, err = net.Listen("tcp", bind)
+		dial = func() (net.Conn, error) { return client.Dial("tcp", target) }
+	case "R":
+		f.listener, err = client.Listen("tcp", bind)
+		dial = func() (net.Conn, error) { return net.Dial("tcp", target) }
+	default:
+		return nil, fmt.Errorf("unknown forward kind %s", kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", bind, err)
+	}
+	go func() {
+		for {
+			conn, err := f.listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				remote, err := dial()
+				if err != nil {
+					return
+				}
+				defer remote.Close()
+				relay(conn, remote)
+			}()
+		}
+	}()
+	return f, nil
+}
+
+// relay copies a and b into each other until both directions are done.
+func relay(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+	}
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+}
+
+// ParseForwardSpec splits an ssh style "[bind_address:]port:host:hostport"
+// forward, the bind address defaults to localhost.
+func ParseForwardSpec(spec string) (bind, target string, err error) {
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 3:
+		return net.JoinHostPort("localhost", parts[0]), net.JoinHostPort(parts[1], parts[2]), nil
+	case 4:
+		return net.JoinHostPort(parts[0], parts[1]), net.JoinHostPort(parts[2], parts[3]), nil
+	}
+	return "", "", fmt.Errorf("bad forwarding specification %q", spec)
+}
+
+// ParseBindSpec parses the "[bind_address:]port" of a forward to cancel.
+func ParseBindSpec(spec string) (string, error) {
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 1:
+		return net.JoinHostPort("localhost", parts[0]), nil
+	case 2:
+		return net.JoinHostPort(parts[0], parts[1]), nil
+	}
+	return "", fmt.Errorf("bad forwarding specification %q", spec)
+}
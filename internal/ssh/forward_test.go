@@ -0,0 +1,54 @@
+package ssh
+
+import "testing"
+
+func TestParseForwardSpec(t *testing.T) {
+	tests := []struct {
+		spec       string
+		wantBind   string
+		wantTarget string
+		wantErr    bool
+	}{
+		{spec: "8080:localhost:80", wantBind: "localhost:8080", wantTarget: "localhost:80"},
+		{spec: "0.0.0.0:8080:db:5432", wantBind: "0.0.0.0:8080", wantTarget: "db:5432"},
+		{spec: "*:8080:db:5432", wantBind: "*:8080", wantTarget: "db:5432"},
+		{spec: "8080", wantErr: true},
+		{spec: "8080:db", wantErr: true},
+		{spec: "a:b:c:d:e", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			bind, target, err := ParseForwardSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseForwardSpec(%q) error = %v, want error %t", tt.spec, err, tt.wantErr)
+			}
+			if bind != tt.wantBind || target != tt.wantTarget {
+				t.Errorf("ParseForwardSpec(%q) = %q, %q, want %q, %q",
+					tt.spec, bind, target, tt.wantBind, tt.wantTarget)
+			}
+		})
+	}
+}
+
+func TestParseBindSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "8080", want: "localhost:8080"},
+		{spec: "127.0.0.1:8080", want: "127.0.0.1:8080"},
+		{spec: "a:b:c", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseBindSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBindSpec(%q) error = %v, want error %t", tt.spec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseBindSpec(%q) = %q, want %q", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
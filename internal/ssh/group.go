@@ -0,0 +1,136 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResultGroup gathers the hosts whose command produced byte-identical output
+// and the same exit code.
+type ResultGroup struct {
+	Hosts  []string
+	Result ExecResult
+}
+
+// GroupResults collapses results with identical stdout, stderr and exit code.
+// Groups are returned biggest first.
+func GroupResults(results []ExecResult) []ResultGroup {
+	var groups []ResultGroup
+	for _, res := range results {
+		found := false
+		for i := range groups {
+			ref := groups[i].Result
+			if ref.ExitCode == res.ExitCode &&
+				ref.TimedOut == res.TimedOut &&
+				errString(ref.Err) == errString(res.Err) &&
+				bytes.Equal(ref.Stdout, res.Stdout) &&
+				bytes.Equal(ref.Stderr, res.Stderr) {
+				groups[i].Hosts = append(groups[i].Hosts, res.Host)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, ResultGroup{
+				Hosts:  []string{res.Host},
+				Result: res,
+			})
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Hosts) > len(groups[j].Hosts)
+	})
+	return groups
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+type hostIndex struct {
+	prefix, suffix string
+	digits         string
+	n              int
+}
+
+// FoldHosts folds numbered host names into a compact range notation, e.g.
+// web01, web02, web03 and web15 become web[01-03,15].
+func FoldHosts(hosts []string) string {
+	var plain []string
+	var indexed []hostIndex
+	for _, host := range hosts {
+		end := len(host)
+		for end > 0 && (host[end-1] < '0' || host[end-1] > '9') {
+			end--
+		}
+		start := end
+		for start > 0 && host[start-1] >= '0' && host[start-1] <= '9' {
+			start--
+		}
+		if start == end {
+			plain = append(plain, host)
+			continue
+		}
+		n, err := strconv.Atoi(host[start:end])
+		if err != nil {
+			plain = append(plain, host)
+			continue
+		}
+		indexed = append(indexed, hostIndex{
+			prefix: host[:start],
+			suffix: host[end:],
+			digits: host[start:end],
+			n:      n,
+		})
+	}
+	sort.Slice(indexed, func(i, j int) bool {
+		if indexed[i].prefix != indexed[j].prefix {
+			return indexed[i].prefix < indexed[j].prefix
+		}
+		if indexed[i].suffix != indexed[j].suffix {
+			return indexed[i].suffix < indexed[j].suffix
+		}
+		return indexed[i].n < indexed[j].n
+	})
+
+	var folded []string
+	for i := 0; i < len(indexed); {
+		j := i
+		for j < len(indexed) && indexed[j].prefix == indexed[i].prefix &&
+			indexed[j].suffix == indexed[i].suffix {
+			j++
+		}
+		folded = append(folded, foldRange(indexed[i:j]))
+		i = j
+	}
+	sort.Strings(plain)
+	return strings.Join(append(folded, plain...), ",")
+}
+
+// foldRange folds hosts sharing the same prefix and suffix.
+func foldRange(hosts []hostIndex) string {
+	if len(hosts) == 1 {
+		return hosts[0].prefix + hosts[0].digits + hosts[0].suffix
+	}
+	var ranges []string
+	for i := 0; i < len(hosts); {
+		j := i
+		for j+1 < len(hosts) && hosts[j+1].n == hosts[j].n+1 &&
+			len(hosts[j+1].digits) == len(hosts[j].digits) {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, hosts[i].digits)
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%s-%s", hosts[i].digits, hosts[j].digits))
+		}
+		i = j + 1
+	}
+	return fmt.Sprintf("%s[%s]%s", hosts[0].prefix, strings.Join(ranges, ","), hosts[0].suffix)
+}
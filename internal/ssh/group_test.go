@@ -0,0 +1,88 @@
+package ssh
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFoldHosts(t *testing.T) {
+	tests := []struct {
+		name  string
+		hosts []string
+		want  string
+	}{
+		{"empty", nil, ""},
+		{"single", []string{"web01"}, "web01"},
+		{"plain", []string{"db", "cache"}, "cache,db"},
+		{"range", []string{"web03", "web01", "web02"}, "web[01-03]"},
+		{"gaps", []string{"web01", "web02", "web03", "web15"}, "web[01-03,15]"},
+		{"suffix", []string{"node1.eu", "node2.eu", "node1.us"}, "node[1-2].eu,node1.us"},
+		{"widths", []string{"web9", "web10"}, "web[9,10]"},
+		{"mixed", []string{"web1", "db", "web2"}, "web[1-2],db"},
+		{"prefixes", []string{"b1", "a1", "a2"}, "a[1-2],b1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FoldHosts(tt.hosts)
+			if got != tt.want {
+				t.Errorf("FoldHosts(%q) = %q, want %q", tt.hosts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupResults(t *testing.T) {
+	ok := func(host, stdout string) ExecResult {
+		return ExecResult{Host: host, Stdout: []byte(stdout)}
+	}
+	tests := []struct {
+		name    string
+		results []ExecResult
+		want    [][]string
+	}{
+		{"empty", nil, nil},
+		{"identical", []ExecResult{ok("a", "x"), ok("b", "x")}, [][]string{{"a", "b"}}},
+		{
+			"biggest first",
+			[]ExecResult{ok("a", "x"), ok("b", "y"), ok("c", "y")},
+			[][]string{{"b", "c"}, {"a"}},
+		},
+		{
+			"stable on ties",
+			[]ExecResult{ok("a", "x"), ok("b", "y")},
+			[][]string{{"a"}, {"b"}},
+		},
+		{
+			"exit code",
+			[]ExecResult{ok("a", "x"), {Host: "b", Stdout: []byte("x"), ExitCode: 1}},
+			[][]string{{"a"}, {"b"}},
+		},
+		{
+			"stderr",
+			[]ExecResult{ok("a", "x"), {Host: "b", Stdout: []byte("x"), Stderr: []byte("warn")}},
+			[][]string{{"a"}, {"b"}},
+		},
+		{
+			"same error",
+			[]ExecResult{{Host: "a", Err: errors.New("refused")}, {Host: "b", Err: errors.New("refused")}},
+			[][]string{{"a", "b"}},
+		},
+		{
+			"timed out",
+			[]ExecResult{ok("a", ""), {Host: "b", TimedOut: true}},
+			[][]string{{"a"}, {"b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			for _, group := range GroupResults(tt.results) {
+				got = append(got, group.Hosts)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GroupResults() hosts = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
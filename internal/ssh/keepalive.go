@@ -0,0 +1,117 @@
+package ssh
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cssh "golang.org/x/crypto/ssh"
+)
+
+// Used when the ssh config sets no ServerAliveInterval/ServerAliveCountMax.
+const (
+	defaultServerAliveInterval = 30 * time.Second
+	defaultServerAliveCountMax = 3
+)
+
+// KeepAlive returns how often a keepalive is sent and how many may go
+// unanswered before the connection is considered dead. A zero interval
+// disables keepalives.
+func (c SSHConfig) KeepAlive() (time.Duration, int) {
+	interval := defaultServerAliveInterval
+	if c.ServerAliveInterval != "" {
+		if n, err := strconv.Atoi(c.ServerAliveInterval); err == nil {
+			interval = time.Duration(n) * time.Second
+		} else if d, err := time.ParseDuration(c.ServerAliveInterval); err == nil {
+			interval = d
+		}
+	}
+	countMax := defaultServerAliveCountMax
+	if n, err := strconv.Atoi(c.ServerAliveCountMax); err == nil && n > 0 {
+		countMax = n
+	}
+	return interval, countMax
+}
+
+// lostConnection is why a connection to host was closed by the keepalive
+// check.
+type lostConnection struct {
+	host string
+	err  error
+}
+
+var (
+	// the entries of a host are dropped once it is connected again
+	lostConnections        sync.Map // *cssh.Client -> lostConnection
+	connectionLostHandlerM sync.Mutex
+	connectionLostHandler  func(host string, err error)
+)
+
+// SetConnectionLostHandler registers f to be called, from a background
+// goroutine, when a connection is closed for not answering keepalives.
+func SetConnectionLostHandler(f func(host string, err error)) {
+	connectionLostHandlerM.Lock()
+	defer connectionLostHandlerM.Unlock()
+	connectionLostHandler = f
+}
+
+// ConnectionLost returns why the client was closed by the keepalive check,
+// or nil.
+func ConnectionLost(client *cssh.Client) error {
+	if lost, has := lostConnections.Load(client); has {
+		return lost.(lostConnection).err
+	}
+	return nil
+}
+
+// forgetLostConnections drops the lost connections to host, it is called
+// once host is connected again.
+func forgetLostConnections(host string) {
+	lostConnections.Range(func(client, lost any) bool {
+		if lost.(lostConnection).host == host {
+			lostConnections.Delete(client)
+		}
+		return true
+	})
+}
+
+// keepAlive sends a keepalive@openssh.com request every interval until the
+// client is closed, and closes it once countMax requests went unanswered.
+func keepAlive(client *cssh.Client, host string, interval time.Duration, countMax int) {
+	closed := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(closed)
+	}()
+
+	var unanswered atomic.Int32
+	for {
+		select {
+		case <-closed:
+			return
+		case <-time.After(interval):
+		}
+		if n := int(unanswered.Load()); n >= countMax {
+			err := fmt.Errorf("connection to %s lost: no reply to %d keepalives", host, n)
+			lostConnections.Store(client, lostConnection{host: host, err: err})
+			client.Close()
+			connectionLostHandlerM.Lock()
+			handler := connectionLostHandler
+			connectionLostHandlerM.Unlock()
+			if handler != nil {
+				handler(host, err)
+			}
+			return
+		}
+		unanswered.Add(1)
+		go func() {
+			// any reply, even a refusal, proves the server is alive
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			if err == nil {
+				unanswered.Store(0)
+			}
+		}()
+	}
+}
@@ -0,0 +1,146 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	cssh "golang.org/x/crypto/ssh"
+)
+
+// MetricsSample is a reading of the counters of a host, the CPU and network
+// counters only make sense compared to a previous sample.
+type MetricsSample struct {
+	Time         time.Time
+	Load1        float64
+	CPUs         int
+	CPUIdle      uint64 // jiffies
+	CPUTotal     uint64
+	MemTotal     uint64 // bytes
+	MemAvailable uint64
+	DiskTotal    uint64 // bytes, of /
+	DiskUsed     uint64
+	NetRx        uint64 // bytes, all interfaces but lo
+	NetTx        uint64
+}
+
+// metricsCommand prints the counters read from /proc as key=value lines, the
+// interfaces of /proc/net/dev are passed as is and summed by parseMetrics.
+const metricsCommand = `(
+	echo "load=$(cut -d' ' -f1 /proc/loadavg)"
+	awk '/^cpu / {total = 0; for (i = 2; i <= NF; i++) total += $i; printf "cpu_idle=%.0f\ncpu_total=%.0f\n", $5 + $6, total}
+		/^cpu[0-9]/ {n++} END {print "cpus=" n}' /proc/stat
+	awk '/^MemTotal:/ {print "mem_total_kb=" $2} /^MemAvailable:/ {print "mem_available_kb=" $2}' /proc/meminfo
+	df -Pk / | awk 'NR == 2 {print "disk_total_kb=" $2; print "disk_used_kb=" $3}'
+	sed -n '3,$s/^/net_dev=/p' /proc/net/dev
+) 2>/dev/null`
+
+// CollectMetrics reads the counters of the host of client.
+func CollectMetrics(ctx context.Context, client *cssh.Client) (MetricsSample, error) {
+	res := RunCommand(ctx, client, metricsCommand)
+	if res.Err != nil {
+		return MetricsSample{}, res.Err
+	}
+	if res.ExitCode != 0 {
+		return MetricsSample{}, fmt.Errorf("reading metrics failed with exit code %d", res.ExitCode)
+	}
+	sample := parseMetrics(res.Stdout)
+	sample.Time = time.Now()
+	if sample.CPUTotal == 0 {
+		return MetricsSample{}, fmt.Errorf("no metrics, /proc is not readable")
+	}
+	return sample, nil
+}
+
+func parseMetrics(output []byte) MetricsSample {
+	var sample MetricsSample
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		n, _ := strconv.ParseUint(value, 10, 64)
+		switch key {
+		case "load":
+			sample.Load1, _ = strconv.ParseFloat(value, 64)
+		case "cpus":
+			sample.CPUs = int(n)
+		case "cpu_idle":
+			sample.CPUIdle = n
+		case "cpu_total":
+			sample.CPUTotal = n
+		case "mem_total_kb":
+			sample.MemTotal = n * 1024
+		case "mem_available_kb":
+			sample.MemAvailable = n * 1024
+		case "disk_total_kb":
+			sample.DiskTotal = n * 1024
+		case "disk_used_kb":
+			sample.DiskUsed = n * 1024
+		case "net_dev":
+			iface, rx, tx, ok := parseNetDev(value)
+			if ok && iface != "lo" {
+				sample.NetRx += rx
+				sample.NetTx += tx
+			}
+		}
+	}
+	return sample
+}
+
+// parseNetDev parses an interface line of /proc/net/dev, e.g.
+// "eth0: 2511172 538 0 0 0 0 0 0 66884 674 0 0 0 0 0 0", where large
+// counters may touch the colon.
+func parseNetDev(line string) (iface string, rx, tx uint64, ok bool) {
+	name, counters, found := strings.Cut(line, ":")
+	fields := strings.Fields(counters)
+	if !found || len(fields) < 9 {
+		return "", 0, 0, false
+	}
+	rx, rxErr := strconv.ParseUint(fields[0], 10, 64)
+	tx, txErr := strconv.ParseUint(fields[8], 10, 64)
+	if rxErr != nil || txErr != nil {
+		return "", 0, 0, false
+	}
+	return strings.TrimSpace(name), rx, tx, true
+}
+
+// CPUPercent returns the CPU usage between prev and s.
+func (s MetricsSample) CPUPercent(prev MetricsSample) float64 {
+	total := float64(s.CPUTotal) - float64(prev.CPUTotal)
+	if total <= 0 {
+		return 0
+	}
+	idle := float64(s.CPUIdle) - float64(prev.CPUIdle)
+	return max(0, 100*(total-idle)/total)
+}
+
+// NetRates returns the bytes received and sent per second between prev and
+// s.
+func (s MetricsSample) NetRates(prev MetricsSample) (float64, float64) {
+	elapsed := s.Time.Sub(prev.Time).Seconds()
+	if elapsed <= 0 || s.NetRx < prev.NetRx || s.NetTx < prev.NetTx { // counters reset
+		return 0, 0
+	}
+	return float64(s.NetRx-prev.NetRx) / elapsed, float64(s.NetTx-prev.NetTx) / elapsed
+}
+
+func (s MetricsSample) MemPercent() float64 {
+	if s.MemTotal == 0 {
+		return 0
+	}
+	return 100 * float64(s.MemTotal-min(s.MemAvailable, s.MemTotal)) / float64(s.MemTotal)
+}
+
+func (s MetricsSample) DiskPercent() float64 {
+	if s.DiskTotal == 0 {
+		return 0
+	}
+	return 100 * float64(s.DiskUsed) / float64(s.DiskTotal)
+}
@@ -0,0 +1,165 @@
+package ssh
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// procNetDev is a /proc/net/dev capture, the counters of enp3s0 touch the
+// colon.
+const procNetDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 137040693   22784    0    0    0     0          0         0 137040693   22784    0    0    0     0       0          0
+  eth0: 2511172     538    0    0    0     0          0         0    66884     674    0    0    0     0       0          0
+enp3s0:98765432101 8871092    0   12    0     0          0      3011 12345678901 5610023    0    0    0     0       0          0
+docker0:       0       0    0    0    0     0          0         0        0       0    0    0    0     0       0          0
+`
+
+func TestParseNetDev(t *testing.T) {
+	tests := []struct {
+		line      string
+		wantIface string
+		wantRx    uint64
+		wantTx    uint64
+		wantOK    bool
+	}{
+		{
+			line:      "    lo: 137040693   22784    0    0    0     0          0         0 137040693   22784    0    0    0     0       0          0",
+			wantIface: "lo", wantRx: 137040693, wantTx: 137040693, wantOK: true,
+		},
+		{
+			line:      "  eth0: 2511172     538    0    0    0     0          0         0    66884     674    0    0    0     0       0          0",
+			wantIface: "eth0", wantRx: 2511172, wantTx: 66884, wantOK: true,
+		},
+		{
+			line:      "enp3s0:98765432101 8871092    0   12    0     0          0      3011 12345678901 5610023    0    0    0     0       0          0",
+			wantIface: "enp3s0", wantRx: 98765432101, wantTx: 12345678901, wantOK: true,
+		},
+		{line: "Inter-|   Receive                                                |  Transmit"},
+		{line: "  eth0: 1 2 3"},
+		{line: "  eth0: a 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wantIface, func(t *testing.T) {
+			iface, rx, tx, ok := parseNetDev(tt.line)
+			if ok != tt.wantOK || iface != tt.wantIface || rx != tt.wantRx || tx != tt.wantTx {
+				t.Errorf("parseNetDev(%q) = %q, %d, %d, %t, want %q, %d, %d, %t", tt.line,
+					iface, rx, tx, ok, tt.wantIface, tt.wantRx, tt.wantTx, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseMetrics(t *testing.T) {
+	var netDev strings.Builder
+	// as printed by metricsCommand, without the two header lines
+	for _, line := range strings.Split(procNetDev, "\n")[2:] {
+		if line != "" {
+			netDev.WriteString("net_dev=" + line + "\n")
+		}
+	}
+	tests := []struct {
+		name   string
+		output string
+		want   MetricsSample
+	}{
+		{name: "empty", output: "", want: MetricsSample{}},
+		{
+			name: "full",
+			output: "load=0.52\n" +
+				"cpu_idle=770135\n" +
+				"cpu_total=846342\n" +
+				"cpus=4\n" +
+				"mem_total_kb=8026156\n" +
+				"mem_available_kb=5864220\n" +
+				"disk_total_kb=81106868\n" +
+				"disk_used_kb=23311076\n" +
+				netDev.String(),
+			want: MetricsSample{
+				Load1:        0.52,
+				CPUs:         4,
+				CPUIdle:      770135,
+				CPUTotal:     846342,
+				MemTotal:     8026156 * 1024,
+				MemAvailable: 5864220 * 1024,
+				DiskTotal:    81106868 * 1024,
+				DiskUsed:     23311076 * 1024,
+				NetRx:        2511172 + 98765432101,
+				NetTx:        66884 + 12345678901,
+			},
+		},
+		{
+			name:   "loopback only",
+			output: "net_dev=    lo: 1000 1 0 0 0 0 0 0 2000 1 0 0 0 0 0 0\n",
+			want:   MetricsSample{},
+		},
+		{
+			name:   "garbage ignored",
+			output: "banner\nload=high\nnet_dev=broken\ncpus=2\n",
+			want:   MetricsSample{CPUs: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseMetrics([]byte(tt.output))
+			if got != tt.want {
+				t.Errorf("parseMetrics() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricsSampleRates(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		prev, cur MetricsSample
+		wantCPU   float64
+		wantRx    float64
+		wantTx    float64
+		wantMem   float64
+		wantDisk  float64
+	}{
+		{
+			name: "busy",
+			prev: MetricsSample{Time: start, CPUIdle: 100, CPUTotal: 1000, NetRx: 1000, NetTx: 500},
+			cur: MetricsSample{
+				Time:    start.Add(2 * time.Second),
+				CPUIdle: 150, CPUTotal: 1200,
+				NetRx: 5000, NetTx: 700,
+				MemTotal: 1000, MemAvailable: 250,
+				DiskTotal: 200, DiskUsed: 50,
+			},
+			wantCPU:  75,
+			wantRx:   2000,
+			wantTx:   100,
+			wantMem:  75,
+			wantDisk: 25,
+		},
+		{
+			name: "counters reset",
+			prev: MetricsSample{Time: start, CPUTotal: 1000, NetRx: 5000, NetTx: 500},
+			cur:  MetricsSample{Time: start.Add(time.Second), CPUTotal: 1000, NetRx: 10, NetTx: 10},
+		},
+		{
+			name: "same time",
+			prev: MetricsSample{Time: start, NetRx: 1},
+			cur:  MetricsSample{Time: start, NetRx: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rx, tx := tt.cur.NetRates(tt.prev)
+			got := []float64{tt.cur.CPUPercent(tt.prev), rx, tx, tt.cur.MemPercent(), tt.cur.DiskPercent()}
+			want := []float64{tt.wantCPU, tt.wantRx, tt.wantTx, tt.wantMem, tt.wantDisk}
+			for i := range got {
+				if math.Abs(got[i]-want[i]) > 1e-9 {
+					t.Errorf("cpu, rx, tx, mem, disk = %v, want %v", got, want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package ssh
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	cssh "golang.org/x/crypto/ssh"
+)
+
+var poolIdleTimeout = 5 * time.Minute
+
+func init() {
+	customTimeout := os.Getenv("S1H_IDLE_TIMEOUT_SEC")
+	if customTimeout != "" {
+		n, err := strconv.Atoi(customTimeout)
+		if err != nil {
+			log.Fatalf("S1H_IDLE_TIMEOUT_SEC wrong format: %v", err)
+		}
+		poolIdleTimeout = time.Duration(n) * time.Second
+	}
+}
+
+// A connection left unused for this long is checked with a keepalive before
+// being handed out again.
+const poolCheckAfter = 15 * time.Second
+
+// Pool shares one authenticated connection per host. A connection is in use
+// between Get and Put, it is closed once it has not been used for the idle
+// timeout, and dialed again when it died.
+type Pool struct {
+	mu       sync.Mutex
+	conns    map[string]*pooledConn
+	dialing  map[string]*sync.Mutex
+	onChange func(host string)
+	stop     chan struct{}
+}
+
+type pooledConn struct {
+	client   *cssh.Client
+	users    int
+	lastUsed time.Time
+	done     chan struct{} // closed once the connection is closed
+}
+
+// NewPool starts a pool, onChange, when set, is called from any goroutine
+// each time a host may have been connected or disconnected, Connected tells
+// which.
+func NewPool(onChange func(host string)) *Pool {
+	p := &Pool{
+		conns:    make(map[string]*pooledConn),
+		dialing:  make(map[string]*sync.Mutex),
+		onChange: onChange,
+		stop:     make(chan struct{}),
+	}
+	if poolIdleTimeout > 0 {
+		go p.closeIdle()
+	}
+	return p
+}
+
+// Get returns the connection to the host, dialing it when there is none or
+// it died. Every Get must be followed by a Put once done with the client.
+func (p *Pool) Get(cfg SSHConfig) (*cssh.Client, error) {
+	p.mu.Lock()
+	dialing, has := p.dialing[cfg.Host]
+	if !has {
+		dialing = &sync.Mutex{}
+		p.dialing[cfg.Host] = dialing
+	}
+	p.mu.Unlock()
+	// one dial at a time per host, concurrent Gets share its result
+	dialing.Lock()
+	defer dialing.Unlock()
+
+	if client := p.take(cfg.Host); client != nil {
+		return client, nil
+	}
+	client, err := SSHClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn := &pooledConn{
+		client:   client,
+		users:    1,
+		lastUsed: time.Now(),
+		done:     make(chan struct{}),
+	}
+	p.mu.Lock()
+	p.conns[cfg.Host] = conn
+	p.mu.Unlock()
+	go func() {
+		_ = client.Wait()
+		p.mu.Lock()
+		if p.conns[cfg.Host] == conn {
+			delete(p.conns, cfg.Host)
+		}
+		p.mu.Unlock()
+		close(conn.done)
+		p.changed(cfg.Host)
+	}()
+	p.changed(cfg.Host)
+	return client, nil
+}
+
+// take marks the pooled connection to host as used and returns it, nil when
+// there is no live connection.
+func (p *Pool) take(host string) *cssh.Client {
+	p.mu.Lock()
+	conn, has := p.conns[host]
+	if !has {
+		p.mu.Unlock()
+		return nil
+	}
+	check := conn.users == 0 && time.Since(conn.lastUsed) > poolCheckAfter
+	conn.users++
+	conn.lastUsed = time.Now()
+	p.mu.Unlock()
+
+	if check && !alive(conn.client) {
+		conn.client.Close()
+		<-conn.done
+		return nil
+	}
+	select {
+	case <-conn.done:
+		return nil
+	default:
+		return conn.client
+	}
+}
+
+// alive reports whether the server answers a keepalive in time.
+func alive(client *cssh.Client) bool {
+	reply := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		reply <- err
+	}()
+	select {
+	case err := <-reply:
+		return err == nil
+	case <-time.After(sshTimeout):
+		return false
+	}
+}
+
+// GetMany gets the connections to every host concurrently. The clients of
+// the hosts that failed are nil and their errors are joined.
+func (p *Pool) GetMany(cfgs []SSHConfig) ([]*cssh.Client, error) {
+	clients := make([]*cssh.Client, len(cfgs))
+	errs := make([]error, len(cfgs))
+	var wg sync.WaitGroup
+	wg.Add(len(cfgs))
+	for i := range cfgs {
+		go func(i int) {
+			defer wg.Done()
+			clients[i], errs[i] = p.Get(cfgs[i])
+		}(i)
+	}
+	wg.Wait()
+	return clients, errors.Join(errs...)
+}
+
+// Put hands a client obtained with Get back to the pool.
+func (p *Pool) Put(client *cssh.Client) {
+	if client == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range p.conns {
+		if conn.client == client {
+			conn.users--
+			conn.lastUsed = time.Now()
+			return
+		}
+	}
+}
+
+// PutMany hands back the clients of GetMany, nil ones included.
+func (p *Pool) PutMany(clients []*cssh.Client) {
+	for _, client := range clients {
+		p.Put(client)
+	}
+}
+
+// Connected reports whether the pool holds a connection to the host.
+func (p *Pool) Connected(host string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, has := p.conns[host]
+	return has
+}
+
+// PoolStat describes a pooled connection.
+type PoolStat struct {
+	Host  string        `json:"host"`
+	Users int           `json:"users"`
+	Idle  time.Duration `json:"idle"`
+}
+
+// Stats lists the pooled connections sorted by host, Idle is zero for the
+// connections in use.
+func (p *Pool) Stats() []PoolStat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]PoolStat, 0, len(p.conns))
+	for host, conn := range p.conns {
+		stat := PoolStat{Host: host, Users: conn.users}
+		if conn.users <= 0 {
+			stat.Idle = time.Since(conn.lastUsed)
+		}
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Host < stats[j].Host
+	})
+	return stats
+}
+
+// Close closes every connection, used or not.
+func (p *Pool) Close() {
+	close(p.stop)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range p.conns {
+		conn.client.Close()
+	}
+}
+
+func (p *Pool) closeIdle() {
+	ticker := time.NewTicker(min(poolIdleTimeout, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		for _, conn := range p.conns {
+			if conn.users <= 0 && time.Since(conn.lastUsed) > poolIdleTimeout {
+				conn.client.Close()
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *Pool) changed(host string) {
+	if p.onChange != nil {
+		p.onChange(host)
+	}
+}
@@ -0,0 +1,212 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cssh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type ProbeStatus int
+
+const (
+	ProbeUnknown ProbeStatus = iota // not probed yet
+	ProbeOK
+	ProbeUnreachable
+	ProbeTimeout
+	ProbeNoSSH
+	ProbeHostKeyMismatch
+	ProbeAuthFailed
+)
+
+func (s ProbeStatus) String() string {
+	switch s {
+	case ProbeOK:
+		return "ok"
+	case ProbeUnreachable:
+		return "unreachable"
+	case ProbeTimeout:
+		return "timeout"
+	case ProbeNoSSH:
+		return "port open, no SSH"
+	case ProbeHostKeyMismatch:
+		return "host key mismatch"
+	case ProbeAuthFailed:
+		return "port open, auth failed"
+	}
+	return "unknown"
+}
+
+// ProbeResult is the outcome of probing a host with Probe.
+type ProbeResult struct {
+	Status ProbeStatus
+	// Banner is the version announced by the server, e.g. SSH-2.0-OpenSSH_9.6.
+	Banner string
+	// Fingerprint is the SHA256 fingerprint of the host key, KnownHostKey
+	// tells whether it is listed in ~/.ssh/known_hosts.
+	Fingerprint  string
+	KnownHostKey bool
+	// Latency is the time taken to open the TCP connection, one round trip.
+	Latency time.Duration
+	Checked time.Time
+	Err     error
+}
+
+// Reachable tells whether the host answers on its SSH port.
+func (r ProbeResult) Reachable() bool {
+	switch r.Status {
+	case ProbeOK, ProbeHostKeyMismatch, ProbeAuthFailed:
+		return true
+	}
+	return false
+}
+
+var errHostKeyMismatch = errors.New("host key mismatch")
+
+// Probe checks the host at the SSH level: it completes the handshake,
+// verifying the host key against ~/.ssh/known_hosts, and authenticates when
+// auth is set. Hosts with no known key are not rejected, like the other
+// connections of s1h.
+func Probe(cfg SSHConfig, timeout time.Duration, auth bool) (res ProbeResult) {
+	res.Checked = time.Now()
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", cfg.Endpoint(), timeout)
+	if err != nil {
+		res.Status, res.Err = ProbeUnreachable, err
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			res.Status = ProbeTimeout
+		}
+		return res
+	}
+	res.Latency = time.Since(start)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	config := &cssh.ClientConfig{
+		User: cfg.User,
+		HostKeyCallback: func(hostname string, remote net.Addr, key cssh.PublicKey) error {
+			res.Fingerprint = cssh.FingerprintSHA256(key)
+			known, err := checkKnownHost(hostname, remote, key)
+			if err != nil {
+				return err
+			}
+			res.KnownHostKey = known
+			return nil
+		},
+		Timeout: timeout,
+	}
+	if auth {
+		config.Auth = probeAuthMethods(cfg)
+	}
+	banner := &bannerConn{Conn: conn}
+	sconn, chans, reqs, err := cssh.NewClientConn(banner, cfg.Endpoint(), config)
+	res.Banner = banner.version()
+	switch {
+	case err == nil:
+		res.Status = ProbeOK
+		cssh.NewClient(sconn, chans, reqs).Close()
+	case errors.Is(err, errHostKeyMismatch):
+		res.Status, res.Err = ProbeHostKeyMismatch, err
+	case res.Fingerprint == "":
+		// the key exchange did not complete
+		res.Status, res.Err = ProbeNoSSH, err
+		var netErr net.Error
+		if res.Banner != "" && errors.As(err, &netErr) && netErr.Timeout() {
+			res.Status = ProbeTimeout
+		}
+	case !auth:
+		res.Status = ProbeOK // only the "none" method was tried
+	default:
+		res.Status, res.Err = ProbeAuthFailed, err
+	}
+	return res
+}
+
+// checkKnownHost tells whether key is the known key of the host, an error is
+// returned when another key of the same type is known.
+func checkKnownHost(hostname string, remote net.Addr, key cssh.PublicKey) (bool, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return false, nil
+	}
+	callback, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil { // no known_hosts
+		return false, nil
+	}
+	err = callback(hostname, remote, key)
+	var keyErr *knownhosts.KeyError
+	var revokedErr *knownhosts.RevokedError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &revokedErr):
+		return false, errHostKeyMismatch
+	case errors.As(err, &keyErr):
+		for _, want := range keyErr.Want {
+			if want.Key.Type() == key.Type() {
+				return false, errHostKeyMismatch
+			}
+		}
+	}
+	return false, nil
+}
+
+// probeAuthMethods authenticates like dialSSH, trying every default key over
+// the same connection.
+func probeAuthMethods(cfg SSHConfig) []cssh.AuthMethod {
+	if cfg.Password != "" {
+		return []cssh.AuthMethod{cssh.Password(cfg.Password)}
+	}
+	if cfg.IdentityFile != "" {
+		signer, err := LoadIdentifyFile(cfg.IdentityFile)
+		if err != nil {
+			return nil
+		}
+		return []cssh.AuthMethod{cssh.PublicKeys(signer)}
+	}
+	return []cssh.AuthMethod{cssh.PublicKeysCallback(func() ([]cssh.Signer, error) {
+		keys, err := findExistingPrivateKeys()
+		if err != nil {
+			return nil, err
+		}
+		var signers []cssh.Signer
+		for _, key := range keys {
+			if signer, err := LoadIdentifyFile(key); err == nil {
+				signers = append(signers, signer)
+			}
+		}
+		return signers, nil
+	})}
+}
+
+// bannerConn records the beginning of what the server sends, which starts
+// with its version line.
+type bannerConn struct {
+	net.Conn
+	head []byte
+}
+
+func (c *bannerConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if len(c.head) < 256 {
+		c.head = append(c.head, p[:min(n, 256-len(c.head))]...)
+	}
+	return n, err
+}
+
+func (c *bannerConn) version() string {
+	// servers may send other lines before the version
+	for _, line := range bytes.Split(c.head, []byte("\n")) {
+		if version, found := strings.CutPrefix(string(line), "SSH-"); found {
+			return "SSH-" + strings.TrimRight(version, "\r")
+		}
+	}
+	return ""
+}
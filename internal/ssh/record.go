@@ -0,0 +1,187 @@
+package ssh
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// CastHeader is the first line of an asciicast v2 file.
+type CastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// CastEvent is an output ("o") or resize ("r") event, Time is in seconds
+// since the start of the recording.
+type CastEvent struct {
+	Time float64
+	Type string
+	Data string
+}
+
+// Recorder writes a terminal session to an asciicast v2 file.
+type Recorder struct {
+	Path    string
+	mu      sync.Mutex
+	file    *os.File
+	start   time.Time
+	partial []byte // incomplete UTF-8 sequence of the last write
+}
+
+// NewRecorder creates a recording of a cols x rows session on host in dir.
+func NewRecorder(dir, host string, cols, rows int) (*Recorder, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	start := time.Now()
+	base := fmt.Sprintf("%s-%s",
+		strings.ReplaceAll(host, string(filepath.Separator), "_"),
+		start.Format("20060102-150405"))
+	// sessions opened on the same host within a second get a suffix
+	var path string
+	var file *os.File
+	for i := 1; ; i++ {
+		name := base + ".cast"
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d.cast", base, i)
+		}
+		path = filepath.Join(dir, name)
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+	header, err := json.Marshal(CastHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: start.Unix(),
+		Title:     host,
+		Env:       map[string]string{"TERM": "xterm-256color"},
+	})
+	if err == nil {
+		_, err = file.Write(append(header, '\n'))
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write recording: %w", err)
+	}
+	return &Recorder{Path: path, file: file, start: start}, nil
+}
+
+// Write records terminal output.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	buf := append(r.partial, p...)
+	n := completeRunes(buf)
+	r.partial = append([]byte(nil), buf[n:]...)
+	if n == 0 {
+		return len(p), nil
+	}
+	err := r.event("o", string(buf[:n]))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Resize records a terminal resize.
+func (r *Recorder) Resize(cols, rows int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.partial) != 0 {
+		_ = r.event("o", string(r.partial))
+		r.partial = nil
+	}
+	return r.file.Close()
+}
+
+func (r *Recorder) event(kind, data string) error {
+	line, err := json.Marshal([]any{time.Since(r.start).Seconds(), kind, data})
+	if err != nil {
+		return err
+	}
+	_, err = r.file.Write(append(line, '\n'))
+	return err
+}
+
+// completeRunes returns the length of buf without its trailing incomplete
+// UTF-8 sequence, if any.
+func completeRunes(buf []byte) int {
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(buf[i]) {
+			if !utf8.FullRune(buf[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(buf)
+}
+
+// ReadCast parses an asciicast v2 recording.
+func ReadCast(r io.Reader) (CastHeader, []CastEvent, error) {
+	var header CastHeader
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if !scanner.Scan() {
+		if scanner.Err() != nil {
+			return header, nil, scanner.Err()
+		}
+		return header, nil, fmt.Errorf("empty recording")
+	}
+	err := json.Unmarshal(scanner.Bytes(), &header)
+	if err != nil {
+		return header, nil, fmt.Errorf("broken recording header: %w", err)
+	}
+	if header.Version != 2 {
+		return header, nil, fmt.Errorf("unsupported asciicast version %d", header.Version)
+	}
+
+	var events []CastEvent
+	for line := 2; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var fields []any
+		err = json.Unmarshal(scanner.Bytes(), &fields)
+		if err != nil {
+			return header, nil, fmt.Errorf("broken recording line %d: %w", line, err)
+		}
+		var event CastEvent
+		var ok1, ok2, ok3 bool
+		if len(fields) == 3 {
+			event.Time, ok1 = fields[0].(float64)
+			event.Type, ok2 = fields[1].(string)
+			event.Data, ok3 = fields[2].(string)
+		}
+		if !ok1 || !ok2 || !ok3 {
+			return header, nil, fmt.Errorf("broken recording line %d: expected [time, type, data]", line)
+		}
+		events = append(events, event)
+	}
+	return header, events, scanner.Err()
+}
@@ -0,0 +1,122 @@
+package ssh
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCast(t *testing.T) {
+	const header = `{"version": 2, "width": 80, "height": 24, "title": "web01"}` + "\n"
+	tests := []struct {
+		name       string
+		cast       string
+		wantHeader CastHeader
+		wantEvents []CastEvent
+		wantErr    string
+	}{
+		{
+			name:       "header only",
+			cast:       header,
+			wantHeader: CastHeader{Version: 2, Width: 80, Height: 24, Title: "web01"},
+		},
+		{
+			name:       "events",
+			cast:       header + `[0.5, "o", "$ "]` + "\n" + `[1.25, "r", "100x30"]` + "\n",
+			wantHeader: CastHeader{Version: 2, Width: 80, Height: 24, Title: "web01"},
+			wantEvents: []CastEvent{
+				{Time: 0.5, Type: "o", Data: "$ "},
+				{Time: 1.25, Type: "r", Data: "100x30"},
+			},
+		},
+		{
+			name:       "blank lines and no final newline",
+			cast:       header + "\n  \n" + `[0.1, "o", "\u001b[1mé\r\n"]`,
+			wantHeader: CastHeader{Version: 2, Width: 80, Height: 24, Title: "web01"},
+			wantEvents: []CastEvent{{Time: 0.1, Type: "o", Data: "\x1b[1mé\r\n"}},
+		},
+		{name: "empty", cast: "", wantErr: "empty recording"},
+		{name: "broken header", cast: "{\n", wantErr: "broken recording header"},
+		{name: "version 1", cast: `{"version": 1}` + "\n", wantErr: "unsupported asciicast version 1"},
+		{name: "broken event", cast: header + "[0.1, \"o\"\n", wantErr: "broken recording line 2"},
+		{name: "short event", cast: header + `[0.1, "o"]` + "\n", wantErr: "broken recording line 2"},
+		{name: "wrong types", cast: header + `["0.1", "o", "x"]` + "\n", wantErr: "broken recording line 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotHeader, gotEvents, err := ReadCast(strings.NewReader(tt.cast))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadCast() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadCast() error = %v", err)
+			}
+			if !reflect.DeepEqual(gotHeader, tt.wantHeader) {
+				t.Errorf("ReadCast() header = %+v, want %+v", gotHeader, tt.wantHeader)
+			}
+			if !reflect.DeepEqual(gotEvents, tt.wantEvents) {
+				t.Errorf("ReadCast() events = %+v, want %+v", gotEvents, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	recorders := make([]*Recorder, 3)
+	for i := range recorders {
+		rec, err := NewRecorder(dir, "web01", 80, 24)
+		if err != nil {
+			t.Fatalf("NewRecorder() error = %v", err)
+		}
+		recorders[i] = rec
+	}
+	seen := map[string]bool{}
+	for _, rec := range recorders {
+		if seen[rec.Path] {
+			t.Errorf("NewRecorder() reused %s", rec.Path)
+		}
+		seen[rec.Path] = true
+	}
+
+	rec := recorders[0]
+	// é split across writes is recorded once complete
+	for _, p := range []string{"a\xc3", "\xa9b"} {
+		_, err := rec.Write([]byte(p))
+		if err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	err := rec.Resize(100, 30)
+	if err != nil {
+		t.Fatalf("Resize() error = %v", err)
+	}
+	for _, rec := range recorders {
+		rec.Close()
+	}
+
+	f, err := os.Open(rec.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	header, events, err := ReadCast(f)
+	if err != nil {
+		t.Fatalf("ReadCast() error = %v", err)
+	}
+	if header.Width != 80 || header.Height != 24 || header.Title != "web01" {
+		t.Errorf("header = %+v, want 80x24 web01", header)
+	}
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Type+":"+event.Data)
+	}
+	want := []string{"o:a", "o:éb", "r:100x30"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,206 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cssh "golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrSkipped          = errors.New("skipped")
+	ErrConnectionFailed = errors.New("connection failed")
+)
+
+// RollingOptions splits a multi-host run into successive batches.
+type RollingOptions struct {
+	BatchSize    int // hosts per batch
+	BatchPercent int // or percentage of the hosts per batch
+	Pause        time.Duration
+	// HealthCheck, when set, must succeed on every host of a batch before
+	// the next batch starts.
+	HealthCheck string
+	FailFast    bool
+	// OnBatch, when set, is called before each batch starts.
+	OnBatch func(batch, batches int, hosts []string)
+	// Pool, when set, provides the connections instead of dialing them for
+	// each batch.
+	Pool *Pool
+}
+
+func (o RollingOptions) Enabled() bool {
+	return o.BatchSize > 0 || o.BatchPercent > 0
+}
+
+func (o RollingOptions) size(total int) int {
+	size := o.BatchSize
+	if o.BatchPercent > 0 {
+		size = (total*o.BatchPercent + 99) / 100
+	}
+	return max(1, min(size, total))
+}
+
+// ParseBatch parses a batch size given either as a number of hosts, e.g. "5",
+// or as a percentage, e.g. "25%". An empty text disables batching.
+func ParseBatch(text string) (size, percent int, err error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, 0, nil
+	}
+	if p, isPercent := strings.CutSuffix(text, "%"); isPercent {
+		percent, err = strconv.Atoi(p)
+		if err != nil || percent <= 0 || percent > 100 {
+			return 0, 0, fmt.Errorf("invalid batch percentage: %s", text)
+		}
+		return 0, percent, nil
+	}
+	size, err = strconv.Atoi(text)
+	if err != nil || size <= 0 {
+		return 0, 0, fmt.Errorf("invalid batch size: %s", text)
+	}
+	return size, 0, nil
+}
+
+// RollingExec runs command batch after batch, connecting to the hosts of each
+// batch right before it starts. The returned error explains why the run was
+// aborted, the hosts which did not run are then reported as ErrSkipped.
+func RollingExec(ctx context.Context, configs []SSHConfig, command string,
+	opts MultiExecOptions, rolling RollingOptions, onResult func(i int, res ExecResult)) ([]ExecResult, error) {
+	if opts.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Deadline)
+		defer cancel()
+		opts.Deadline = 0
+	}
+
+	results := make([]ExecResult, len(configs))
+	report := func(i int, res ExecResult) {
+		results[i] = res
+		if onResult != nil {
+			onResult(i, res)
+		}
+	}
+
+	size := rolling.size(len(configs))
+	batches := (len(configs) + size - 1) / size
+	var abort error
+	for start := 0; start < len(configs); start += size {
+		end := min(start+size, len(configs))
+		if abort == nil {
+			abort = ctx.Err()
+		}
+		if abort != nil {
+			for i := start; i < end; i++ {
+				report(i, ExecResult{Host: configs[i].Host, ExitCode: -1, Err: ErrSkipped})
+			}
+			continue
+		}
+		abort = runBatch(ctx, configs[start:end], command, opts, rolling,
+			start/size+1, batches, func(i int, res ExecResult) {
+				report(start+i, res)
+			})
+		if abort == nil && end < len(configs) && rolling.Pause > 0 {
+			select {
+			case <-time.After(rolling.Pause):
+			case <-ctx.Done():
+			}
+		}
+	}
+	return results, abort
+}
+
+func runBatch(ctx context.Context, configs []SSHConfig, command string,
+	opts MultiExecOptions, rolling RollingOptions, batch, batches int,
+	report func(i int, res ExecResult)) error {
+	hosts := make([]string, len(configs))
+	for i := range configs {
+		hosts[i] = configs[i].Host
+	}
+	if rolling.OnBatch != nil {
+		rolling.OnBatch(batch, batches, hosts)
+	}
+
+	clients, errs := dialBatch(configs, rolling.Pool)
+	if rolling.Pool != nil {
+		defer rolling.Pool.PutMany(clients)
+	}
+	var connected []*cssh.Client
+	var connectedHosts []string
+	var indexes []int
+	var failed []string
+	for i := range clients {
+		if errs[i] != nil {
+			report(i, ExecResult{Host: hosts[i], ExitCode: -1,
+				Err: fmt.Errorf("%w: %w", ErrConnectionFailed, errs[i])})
+			failed = append(failed, hosts[i])
+			continue
+		}
+		if rolling.Pool == nil {
+			defer clients[i].Close()
+		}
+		connected = append(connected, clients[i])
+		connectedHosts = append(connectedHosts, hosts[i])
+		indexes = append(indexes, i)
+	}
+
+	results := ExecOnMany(ctx, connectedHosts, connected, command, opts, func(i int, res ExecResult) {
+		report(indexes[i], res)
+	})
+	for _, res := range results {
+		if res.Failed() {
+			failed = append(failed, res.Host)
+		}
+	}
+	if len(failed) != 0 && rolling.FailFast {
+		return fmt.Errorf("batch %d/%d: failed on %s", batch, batches, FoldHosts(failed))
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if rolling.HealthCheck != "" && len(connected) != 0 {
+		// the health check is a plain command, neither fed the script nor
+		// run through sudo
+		checkOpts := opts
+		checkOpts.OnLine = nil
+		checkOpts.Stdin = nil
+		checkOpts.Sudo, checkOpts.SudoPasswords = false, nil
+		checks := ExecOnMany(ctx, connectedHosts, connected, rolling.HealthCheck, checkOpts, nil)
+		var unhealthy []string
+		for _, res := range checks {
+			if res.Failed() {
+				unhealthy = append(unhealthy, res.Host)
+			}
+		}
+		if len(unhealthy) != 0 {
+			return fmt.Errorf("batch %d/%d: health check failed on %s", batch, batches, FoldHosts(unhealthy))
+		}
+	}
+	return nil
+}
+
+// dialBatch connects to every host concurrently, through pool when set,
+// keeping the error of each host which could not be reached.
+func dialBatch(configs []SSHConfig, pool *Pool) ([]*cssh.Client, []error) {
+	clients := make([]*cssh.Client, len(configs))
+	errs := make([]error, len(configs))
+	var wg sync.WaitGroup
+	wg.Add(len(configs))
+	for i := range configs {
+		go func(i int) {
+			defer wg.Done()
+			if pool != nil {
+				clients[i], errs[i] = pool.Get(configs[i])
+			} else {
+				clients[i], errs[i] = SSHClient(configs[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+	return clients, errs
+}
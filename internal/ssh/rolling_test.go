@@ -0,0 +1,100 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseBatch(t *testing.T) {
+	tests := []struct {
+		text        string
+		wantSize    int
+		wantPercent int
+		wantErr     bool
+	}{
+		{text: ""},
+		{text: "  "},
+		{text: "5", wantSize: 5},
+		{text: " 3 ", wantSize: 3},
+		{text: "25%", wantPercent: 25},
+		{text: "100%", wantPercent: 100},
+		{text: "0", wantErr: true},
+		{text: "-2", wantErr: true},
+		{text: "0%", wantErr: true},
+		{text: "101%", wantErr: true},
+		{text: "%", wantErr: true},
+		{text: "five", wantErr: true},
+		{text: "5 %", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			size, percent, err := ParseBatch(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBatch(%q) error = %v, want error %t", tt.text, err, tt.wantErr)
+			}
+			if size != tt.wantSize || percent != tt.wantPercent {
+				t.Errorf("ParseBatch(%q) = %d, %d%%, want %d, %d%%",
+					tt.text, size, percent, tt.wantSize, tt.wantPercent)
+			}
+		})
+	}
+}
+
+func TestRollingOptionsSize(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  RollingOptions
+		total int
+		want  int
+	}{
+		{"size", RollingOptions{BatchSize: 2}, 5, 2},
+		{"size above total", RollingOptions{BatchSize: 10}, 5, 5},
+		{"percent rounds up", RollingOptions{BatchPercent: 25}, 5, 2},
+		{"percent exact", RollingOptions{BatchPercent: 50}, 4, 2},
+		{"small percent", RollingOptions{BatchPercent: 1}, 5, 1},
+		{"all", RollingOptions{BatchPercent: 100}, 7, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.opts.size(tt.total)
+			if got != tt.want {
+				t.Errorf("size(%d) = %d, want %d", tt.total, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollingExecConnectionFailed(t *testing.T) {
+	// a port nothing listens on anymore
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	l.Close()
+	configs := []SSHConfig{{Host: "down", HostName: "127.0.0.1", Port: port, User: "u", Password: "x"}}
+
+	tests := []struct {
+		name string
+		pool *Pool
+	}{
+		{"dialed", nil},
+		{"pooled", NewPool(nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, abort := RollingExec(context.Background(), configs, "true",
+				MultiExecOptions{}, RollingOptions{BatchSize: 1, Pool: tt.pool}, nil)
+			if abort != nil {
+				t.Fatalf("RollingExec() abort = %v", abort)
+			}
+			err := results[0].Err
+			if !errors.Is(err, ErrConnectionFailed) || !strings.Contains(err.Error(), "connection refused") {
+				t.Errorf("RollingExec() error = %v, want %v wrapping connection refused", err, ErrConnectionFailed)
+			}
+		})
+	}
+}
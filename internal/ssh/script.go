@@ -0,0 +1,69 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var shellInterpreters = map[string]struct{}{
+	"sh": {}, "bash": {}, "dash": {}, "zsh": {}, "ksh": {}, "ash": {},
+}
+
+// Script is a local script meant to be fed to remote hosts over stdin.
+type Script struct {
+	Name    string
+	Content []byte
+	Args    []string
+}
+
+func LoadScript(path string, args []string) (Script, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Script{}, fmt.Errorf("failed to read script: %w", err)
+	}
+	return Script{
+		Name:    filepath.Base(path),
+		Content: content,
+		Args:    args,
+	}, nil
+}
+
+// interpreter returns the shebang of the script, empty when there is none.
+func (s Script) interpreter() string {
+	if !bytes.HasPrefix(s.Content, []byte("#!")) {
+		return ""
+	}
+	line, _, _ := bytes.Cut(s.Content[2:], []byte("\n"))
+	return strings.TrimSpace(string(line))
+}
+
+// Command returns the remote command running the script read from stdin.
+// Shell scripts are piped straight into their interpreter, other scripts are
+// written to a temp file executed through their shebang and removed after.
+func (s Script) Command() string {
+	args := make([]string, len(s.Args))
+	for i := range s.Args {
+		args[i] = ShellQuote(s.Args[i])
+	}
+	quotedArgs := strings.Join(args, " ")
+
+	interpreter := s.interpreter()
+	if interpreter == "" {
+		return strings.TrimSpace("sh -s -- " + quotedArgs)
+	}
+	fields := strings.Fields(interpreter)
+	if _, isShell := shellInterpreters[filepath.Base(fields[len(fields)-1])]; isShell {
+		return strings.TrimSpace(interpreter + " -s -- " + quotedArgs)
+	}
+	return strings.TrimSpace(fmt.Sprintf(
+		`f=$(mktemp /tmp/s1h.XXXXXX) && cat > "$f" && chmod 700 "$f" && { "$f" %s; rc=$?; rm -f "$f"; exit $rc; }`,
+		quotedArgs))
+}
+
+// ShellQuote quotes text for a POSIX shell.
+func ShellQuote(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
@@ -0,0 +1,74 @@
+package ssh
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScriptCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		args    []string
+		want    string
+	}{
+		{"no shebang", "echo hi\n", nil, "sh -s --"},
+		{"no shebang with args", "echo $1\n", []string{"a b"}, "sh -s -- 'a b'"},
+		{"bash", "#!/bin/bash\necho hi\n", nil, "/bin/bash -s --"},
+		{"env bash", "#!/usr/bin/env bash\necho hi\n", []string{"x"}, "/usr/bin/env bash -s -- 'x'"},
+		{"shebang spaces", "#! /bin/sh \necho hi\n", nil, "/bin/sh -s --"},
+		{"quoted args", "#!/bin/sh\n", []string{"it's", "$HOME"}, `/bin/sh -s -- 'it'\''s' '$HOME'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := Script{Name: "test", Content: []byte(tt.content), Args: tt.args}
+			got := script.Command()
+			if got != tt.want {
+				t.Errorf("Command() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScriptCommandInterpreted(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		args    []string
+		wantRun string
+	}{
+		{"python", "#!/usr/bin/env python3\nprint(1)\n", nil, `"$f" ;`},
+		{"python with args", "#!/usr/bin/python3\n", []string{"a", "b c"}, `"$f" 'a' 'b c';`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := Script{Name: "test", Content: []byte(tt.content), Args: tt.args}
+			got := script.Command()
+			if !strings.HasPrefix(got, "f=$(mktemp") || !strings.Contains(got, tt.wantRun) {
+				t.Errorf("Command() = %q, want a temp file run with %q", got, tt.wantRun)
+			}
+		})
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", "''"},
+		{"plain", "'plain'"},
+		{"two words", "'two words'"},
+		{"it's", `'it'\''s'`},
+		{"$(rm -rf /)", "'$(rm -rf /)'"},
+		{"''", `''\'''\'''`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := ShellQuote(tt.text)
+			if got != tt.want {
+				t.Errorf("ShellQuote(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
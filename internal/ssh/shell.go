@@ -0,0 +1,88 @@
+package ssh
+
+import (
+	"io"
+	"sync"
+
+	cssh "golang.org/x/crypto/ssh"
+)
+
+var ptyModes = cssh.TerminalModes{
+	cssh.ECHO:          1,
+	cssh.TTY_OP_ISPEED: 14400,
+	cssh.TTY_OP_OSPEED: 14400,
+}
+
+// ShellSession is an interactive shell running in a remote PTY. Keystrokes
+// are written to it and the terminal output is copied to the writer given to
+// OpenShell.
+type ShellSession struct {
+	session *cssh.Session
+	stdin   io.WriteCloser
+}
+
+// OpenShell starts a login shell, or command when set, in a cols x rows PTY,
+// no PTY is requested when tty is false. Both stdout and stderr are copied to
+// output, one write at a time.
+func OpenShell(client *cssh.Client, command string, tty bool, cols, rows int, output io.Writer) (*ShellSession, error) {
+	session, err := newSession(client)
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	out := &syncWriter{w: output}
+	session.Stdout = out
+	session.Stderr = out
+
+	if tty {
+		err = session.RequestPty("xterm-256color", rows, cols, ptyModes)
+		if err != nil {
+			session.Close()
+			return nil, err
+		}
+	}
+	if command != "" {
+		err = session.Start(command)
+	} else {
+		err = session.Shell()
+	}
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	return &ShellSession{session: session, stdin: stdin}, nil
+}
+
+// Write sends keystrokes to the shell.
+func (s *ShellSession) Write(p []byte) (int, error) {
+	return s.stdin.Write(p)
+}
+
+func (s *ShellSession) Resize(cols, rows int) error {
+	return s.session.WindowChange(rows, cols)
+}
+
+// Wait blocks until the shell exits and its output has been copied.
+func (s *ShellSession) Wait() error {
+	return s.session.Wait()
+}
+
+func (s *ShellSession) Close() error {
+	return s.session.Close()
+}
+
+// syncWriter serializes writes coming from the stdout and stderr copies.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
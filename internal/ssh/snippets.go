@@ -0,0 +1,124 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Snippet is a named command, it may contain {{name}} or {{name:default}}
+// placeholders.
+type Snippet struct {
+	Name    string
+	Command string
+}
+
+type Placeholder struct {
+	Name    string
+	Default string
+}
+
+var (
+	snippets         []Snippet
+	placeholderRegex = regexp.MustCompile(`{{\s*([\w-]+)\s*(?::([^}]*))?}}`)
+)
+
+// LoadSnippets reads the snippets file, a JSON object mapping a snippet name
+// to its command. A missing file means no snippets.
+func LoadSnippets(path string) error {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		snippets = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	byName := map[string]string{}
+	err = json.Unmarshal(b, &byName)
+	if err != nil {
+		return fmt.Errorf("snippets file broken: %w", err)
+	}
+	snippets = make([]Snippet, 0, len(byName))
+	for name, command := range byName {
+		snippets = append(snippets, Snippet{Name: name, Command: command})
+	}
+	sort.Slice(snippets, func(i, j int) bool {
+		return snippets[i].Name < snippets[j].Name
+	})
+	return nil
+}
+
+func GetSnippets() []Snippet {
+	return snippets
+}
+
+func GetSnippet(name string) (Snippet, bool) {
+	for i := range snippets {
+		if snippets[i].Name == name {
+			return snippets[i], true
+		}
+	}
+	return Snippet{}, false
+}
+
+// Placeholders returns the placeholders of the snippet, in order of first
+// appearance.
+func (s Snippet) Placeholders() []Placeholder {
+	var res []Placeholder
+	seen := map[string]struct{}{}
+	for _, match := range placeholderRegex.FindAllStringSubmatch(s.Command, -1) {
+		if _, has := seen[match[1]]; has {
+			continue
+		}
+		seen[match[1]] = struct{}{}
+		res = append(res, Placeholder{Name: match[1], Default: match[2]})
+	}
+	return res
+}
+
+// Expand replaces the placeholders with values, falling back to their
+// default. Values are inserted verbatim, not shell quoted.
+func (s Snippet) Expand(values map[string]string) (string, error) {
+	var missing []string
+	command := placeholderRegex.ReplaceAllStringFunc(s.Command, func(text string) string {
+		match := placeholderRegex.FindStringSubmatch(text)
+		if v, has := values[match[1]]; has && v != "" {
+			return v
+		}
+		if match[2] != "" {
+			return match[2]
+		}
+		missing = append(missing, match[1])
+		return text
+	})
+	if len(missing) != 0 {
+		return "", fmt.Errorf("snippet %s: missing value for %s", s.Name, strings.Join(missing, ", "))
+	}
+	return command, nil
+}
+
+// ParseSnippetCall splits "@name key=value..." fields into the snippet and
+// its values. ok is false when fields do not call a snippet.
+func ParseSnippetCall(fields []string) (snippet Snippet, values map[string]string, ok bool, err error) {
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "@") {
+		return Snippet{}, nil, false, nil
+	}
+	name := strings.TrimPrefix(fields[0], "@")
+	snippet, has := GetSnippet(name)
+	if !has {
+		return Snippet{}, nil, true, fmt.Errorf("snippet %s not found", name)
+	}
+	values = map[string]string{}
+	for _, field := range fields[1:] {
+		k, v, found := strings.Cut(field, "=")
+		if !found {
+			return Snippet{}, nil, true, fmt.Errorf("snippet %s: expected key=value, got %s", name, field)
+		}
+		values[k] = v
+	}
+	return snippet, values, true, nil
+}
@@ -0,0 +1,109 @@
+package ssh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSnippetExpand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		values  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{name: "no placeholder", command: "uptime", want: "uptime"},
+		{
+			name:    "value",
+			command: "systemctl restart {{service}}",
+			values:  map[string]string{"service": "nginx"},
+			want:    "systemctl restart nginx",
+		},
+		{
+			name:    "spaces",
+			command: "systemctl restart {{ service }}",
+			values:  map[string]string{"service": "nginx"},
+			want:    "systemctl restart nginx",
+		},
+		{name: "default", command: "tail -n {{lines:100}} log", want: "tail -n 100 log"},
+		{
+			name:    "value over default",
+			command: "tail -n {{lines:100}} log",
+			values:  map[string]string{"lines": "5"},
+			want:    "tail -n 5 log",
+		},
+		{
+			name:    "empty value takes the default",
+			command: "tail -n {{lines:100}} log",
+			values:  map[string]string{"lines": ""},
+			want:    "tail -n 100 log",
+		},
+		{
+			name:    "default with colons",
+			command: "curl {{url:http://localhost:8080/health}}",
+			want:    "curl http://localhost:8080/health",
+		},
+		{name: "default with spaces", command: "echo {{msg:hello world}}", want: "echo hello world"},
+		{
+			name:    "repeated",
+			command: "cp {{file}} {{file}}.bak",
+			values:  map[string]string{"file": "a.conf"},
+			want:    "cp a.conf a.conf.bak",
+		},
+		{name: "dashes", command: "echo {{log-dir:/var/log}}", want: "echo /var/log"},
+		{name: "missing", command: "systemctl restart {{service}}", wantErr: true},
+		{
+			name:    "one missing",
+			command: "{{a}} {{b}}",
+			values:  map[string]string{"a": "x"},
+			wantErr: true,
+		},
+		{name: "shell braces untouched", command: "echo ${HOME} {x}", want: "echo ${HOME} {x}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippet := Snippet{Name: "test", Command: tt.command}
+			got, err := snippet.Expand(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expand() error = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Expand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippetPlaceholders(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    []Placeholder
+	}{
+		{"none", "uptime", nil},
+		{
+			"in order",
+			"{{b}} {{a:1}}",
+			[]Placeholder{{Name: "b"}, {Name: "a", Default: "1"}},
+		},
+		{
+			"first occurrence wins",
+			"{{port:22}} {{port:2222}}",
+			[]Placeholder{{Name: "port", Default: "22"}},
+		},
+		{
+			"default with colons",
+			"{{url:http://localhost:8080}}",
+			[]Placeholder{{Name: "url", Default: "http://localhost:8080"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Snippet{Name: "test", Command: tt.command}.Placeholders()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Placeholders() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
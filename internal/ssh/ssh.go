@@ -7,14 +7,15 @@ import (
 	"io"
 	"io/fs"
 	"log"
-	"net"
 	"os"
 	"os/signal"
 	"os/user"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -31,12 +32,46 @@ type SSHConfig struct {
 	HostName     string
 	IdentityFile string
 	Password     string
+	SudoPassword string
+	// RemoteCommand is run instead of the login shell by interactive sessions.
+	RemoteCommand string
+	RequestTTY    string
+	EscapeChar    string
+	// Keepalive settings, parsed by KeepAlive.
+	ServerAliveInterval string
+	ServerAliveCountMax string
+	ForwardAgent        bool
+	// SendEnv holds the patterns of the local variables sent to the host,
+	// SetEnv the variables set explicitly, see Environment.
+	SendEnv []string
+	SetEnv  []EnvVar
 }
 
 func (c SSHConfig) Endpoint() string {
 	return fmt.Sprintf("%s:%s", c.HostName, c.Port)
 }
 
+// WantsTTY reports whether an interactive session requests a PTY, following
+// the RequestTTY option: no never does, force always does, and yes or auto
+// (the default) do when stdin is a terminal.
+func (c SSHConfig) WantsTTY(stdinIsTerminal bool) bool {
+	switch strings.ToLower(c.RequestTTY) {
+	case "no", "false":
+		return false
+	case "force":
+		return true
+	}
+	return stdinIsTerminal
+}
+
+// SudoSecret returns the sudo password, falling back to the login password.
+func (c SSHConfig) SudoSecret() string {
+	if c.SudoPassword != "" {
+		return c.SudoPassword
+	}
+	return c.Password
+}
+
 //infoPopup(pages, fmt.Sprintf("Error accessing ssh for Host %s: %v",
 //	selectedConfigs[i].Host, err))
 
@@ -107,6 +142,26 @@ func ParseSSHConfig(filePath string) ([]SSHConfig, error) {
 				currentConfig.HostName = value
 			case "IdentityFile":
 				currentConfig.IdentityFile = value
+			case "RemoteCommand":
+				currentConfig.RemoteCommand = value
+			case "RequestTTY":
+				currentConfig.RequestTTY = value
+			case "EscapeChar":
+				currentConfig.EscapeChar = value
+			case "ServerAliveInterval":
+				currentConfig.ServerAliveInterval = value
+			case "ServerAliveCountMax":
+				currentConfig.ServerAliveCountMax = value
+			case "ForwardAgent":
+				currentConfig.ForwardAgent = strings.EqualFold(value, "yes") || strings.EqualFold(value, "true")
+			case "SendEnv":
+				currentConfig.SendEnv = append(currentConfig.SendEnv, splitQuoted(value)...)
+			case "SetEnv":
+				for _, word := range splitQuoted(value) {
+					if v, err := ParseEnvVar(word); err == nil {
+						currentConfig.SetEnv = append(currentConfig.SetEnv, v)
+					}
+				}
 			}
 		}
 	}
@@ -194,18 +249,6 @@ func expandTilde(path string) (string, error) {
 	return path, nil
 }
 
-func CheckSSHPort(host string, port int, timeout time.Duration) bool {
-	address := fmt.Sprintf("%s:%d", host, port)
-
-	conn, err := net.DialTimeout("tcp", address, timeout)
-	if err != nil {
-		return false
-	}
-	defer conn.Close()
-
-	return true
-}
-
 var sshTimeout = 10 * time.Second
 
 func init() {
@@ -219,7 +262,34 @@ func init() {
 	}
 }
 
+// SSHClient connects to the host, keeping the connection alive as set by
+// ServerAliveInterval and ServerAliveCountMax, forwarding the local agent
+// when ForwardAgent is set and sending the variables of Environment to every
+// session. The connection goes through the daemon when one is running, see
+// UseDaemon.
 func SSHClient(cfg SSHConfig) (*cssh.Client, error) {
+	client, err := dialDaemon(daemonSocket, cfg.Host)
+	if errors.Is(err, ErrNoDaemon) {
+		client, err = dialSSH(cfg)
+		if err != nil {
+			return nil, err
+		}
+		forgetLostConnections(cfg.Host)
+		if interval, countMax := cfg.KeepAlive(); interval > 0 {
+			go keepAlive(client, cfg.Host, interval, countMax)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if cfg.ForwardAgent {
+		// like ssh, a missing agent does not prevent connecting
+		_ = forwardAgent(client)
+	}
+	setClientEnv(client, cfg.Host, cfg.Environment())
+	return client, nil
+}
+
+func dialSSH(cfg SSHConfig) (*cssh.Client, error) {
 
 	var config cssh.ClientConfig
 	if cfg.Password != "" {
@@ -264,67 +334,128 @@ func SSHClient(cfg SSHConfig) (*cssh.Client, error) {
 	return cssh.Dial("tcp", cfg.Endpoint(), &config)
 }
 
-func ExecuteSSHShell(cfg SSHConfig) error {
+// ErrDisconnected is returned when the user disconnects with the ~. escape.
+var ErrDisconnected = errors.New("disconnected")
+
+// ExecuteSSHShell opens an interactive session in the local terminal,
+// running command, or the RemoteCommand of the host, instead of the login
+// shell when set. When recordDir is set, the session is recorded there and
+// the path of the recording is returned.
+func ExecuteSSHShell(cfg SSHConfig, command, recordDir string) (string, error) {
 
 	client, err := SSHClient(cfg)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	session, err := client.NewSession()
+	session, err := newSession(client)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer session.Close()
 
-	// Clear the screen to get scrollback height
-	clearScreen()
+	if command == "" {
+		command = cfg.RemoteCommand
+	}
+	stdinFd := int(os.Stdin.Fd())
+	tty := cfg.WantsTTY(term.IsTerminal(stdinFd))
 
 	session.Stdout = os.Stdout
 	session.Stderr = os.Stderr
 	session.Stdin = os.Stdin
 
-	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
-	if err != nil {
-		return err
-	}
-	defer term.Restore(int(os.Stdin.Fd()), oldState)
-
-	width, height, err := term.GetSize(int(os.Stdin.Fd()))
+	width, height, err := term.GetSize(stdinFd)
 	if err != nil {
 		width = 80
 		height = 24
 	}
 
-	err = session.RequestPty("xterm-256color",
-		height, width,
-		cssh.TerminalModes{
-			ssh.ECHO:          1,
-			ssh.TTY_OP_ISPEED: 14400,
-			ssh.TTY_OP_OSPEED: 14400,
-		})
-	if err != nil {
-		return err
-	}
+	var escapes *escapeReader
+	var disconnected atomic.Bool
+	if tty {
+		// Clear the screen to get scrollback height
+		clearScreen()
 
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGWINCH)
+		if term.IsTerminal(stdinFd) {
+			oldState, err := term.MakeRaw(stdinFd)
+			if err != nil {
+				return "", err
+			}
+			defer term.Restore(stdinFd, oldState)
 
-	go func() {
-		for range sigCh {
-			w, h, err := term.GetSize(int(os.Stdin.Fd()))
-			if err == nil {
-				_ = session.WindowChange(h, w)
+			escape, enabled, err := ParseEscapeChar(cfg.EscapeChar)
+			if err != nil {
+				return "", err
+			}
+			if enabled {
+				escapes = newEscapeReader(os.Stdin, os.Stdout, escape, client,
+					func() {
+						disconnected.Store(true)
+						client.Close()
+					},
+					func() { _, _ = term.MakeRaw(stdinFd) },
+					func() { _ = term.Restore(stdinFd, oldState) })
+				session.Stdin = escapes
 			}
 		}
-	}()
+	}
+
+	var rec *Recorder
+	if recordDir != "" {
+		rec, err = NewRecorder(recordDir, cfg.Host, width, height)
+		if err != nil {
+			return "", err
+		}
+		defer rec.Close()
+		session.Stdout = io.MultiWriter(os.Stdout, rec)
+		session.Stderr = io.MultiWriter(os.Stderr, rec)
+	}
 
-	err = session.Shell()
+	if tty {
+		err = session.RequestPty("xterm-256color", height, width, ptyModes)
+		if err != nil {
+			return "", err
+		}
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGWINCH)
+
+		go func() {
+			for range sigCh {
+				w, h, err := term.GetSize(stdinFd)
+				if err == nil {
+					_ = session.WindowChange(h, w)
+					if rec != nil {
+						_ = rec.Resize(w, h)
+					}
+				}
+			}
+		}()
+	}
+
+	if command != "" {
+		err = session.Start(command)
+	} else {
+		err = session.Shell()
+	}
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return session.Wait()
+	err = session.Wait()
+	if lost := ConnectionLost(client); lost != nil {
+		err = lost
+	}
+	if escapes != nil {
+		escapes.closeForwards()
+	}
+	if disconnected.Load() {
+		err = ErrDisconnected
+	}
+	if rec != nil {
+		return rec.Path, err
+	}
+	return "", err
 }
 
 func UploadFile(client *ssh.Client, localFile, remotePath string, progress ProgressDisplayer) error {
@@ -410,8 +541,96 @@ func DownloadFile(client *ssh.Client, remotePath, localFile string, progress Pro
 	return nil
 }
 
+// CopyRemoteToRemote streams a file from one remote host to another without
+// staging it on the local disk.
+func CopyRemoteToRemote(srcClient, dstClient *ssh.Client, srcPath, dstPath string, progress ProgressDisplayer) error {
+	srcSftp, err := sftp.NewClient(srcClient)
+	if err != nil {
+		return fmt.Errorf("failed to create source SFTP client: %w", err)
+	}
+	defer srcSftp.Close()
+
+	dstSftp, err := sftp.NewClient(dstClient)
+	if err != nil {
+		return fmt.Errorf("failed to create destination SFTP client: %w", err)
+	}
+	defer dstSftp.Close()
+
+	srcFile, err := srcSftp.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to open remote file %s: %w", srcPath, err)
+	}
+	defer srcFile.Close()
+
+	info, err := dstSftp.Stat(dstPath)
+	if err == nil {
+		if info.IsDir() {
+			dstPath = path.Join(dstPath, path.Base(srcPath))
+		}
+	}
+	// Create truncates, copying a file onto itself would empty it
+	if srcClient == dstClient && absPath(srcSftp, srcPath) == absPath(dstSftp, dstPath) {
+		return fmt.Errorf("%s: %w", srcPath, ErrSameFile)
+	}
+	dstFile, err := dstSftp.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file %s: %w", dstPath, err)
+	}
+	defer dstFile.Close()
+
+	if progress != nil {
+		stat, _ := srcFile.Stat()
+		progress.SetTotalSize(stat.Size())
+		_, err = io.Copy(dstFile, io.TeeReader(srcFile, progress))
+	} else {
+		_, err = srcFile.WriteTo(dstFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy file content: %w", err)
+	}
+
+	return nil
+}
+
+// ErrSameFile is returned when the source and the destination of a copy are
+// the same file.
+var ErrSameFile = errors.New("source and destination are the same file")
+
+// absPath cleans p, relative paths being resolved from the working directory.
+func absPath(client *sftp.Client, p string) string {
+	if !path.IsAbs(p) {
+		if wd, err := client.Getwd(); err == nil {
+			p = path.Join(wd, p)
+		}
+	}
+	return path.Clean(p)
+}
+
+// ListDir returns the resolved absolute path of dir along with its entries.
+// An empty dir lists the remote working directory.
+func ListDir(client *ssh.Client, dir string) (string, []os.FileInfo, error) {
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+
+	if dir == "" {
+		dir = "."
+	}
+	dir, err = sftpClient.RealPath(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	entries, err := sftpClient.ReadDir(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	return dir, entries, nil
+}
+
 func ExecCommand(client *ssh.Client, command string) ([]byte, error) {
-	sess, err := client.NewSession()
+	sess, err := newSession(client)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,27 @@
+package ssh
+
+import "fmt"
+
+// SudoCommand wraps command to run through sudo. The password is read from
+// the first line of stdin so it never shows up in the command line, the
+// history or the output, the rest of stdin is forwarded to the command.
+func SudoCommand(command string) string {
+	return fmt.Sprintf(`IFS= read -r s1h_pw; `+
+		`if sudo -n true 2>/dev/null; then unset s1h_pw; sudo -n -- sh -c %[1]s; `+
+		`else { printf '%%s\n' "$s1h_pw"; unset s1h_pw; cat; } | sudo -S -p '' -- sh -c %[1]s; fi`,
+		ShellQuote(command))
+}
+
+// SudoStdin prepends the sudo password to stdin, as read by SudoCommand.
+func SudoStdin(password string, stdin []byte) []byte {
+	return append([]byte(password+"\n"), stdin...)
+}
+
+// SudoPasswords maps every host to its sudo password.
+func SudoPasswords(configs []SSHConfig) map[string]string {
+	passwords := make(map[string]string, len(configs))
+	for i := range configs {
+		passwords[configs[i].Host] = configs[i].SudoSecret()
+	}
+	return passwords
+}
@@ -0,0 +1,181 @@
+package tui
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/noboruma/s1h/internal/ssh"
+	"github.com/rivo/tview"
+	cssh "golang.org/x/crypto/ssh"
+)
+
+const broadcastHelp = "Ctrl-] then n/p: next/previous host, b: toggle broadcast, q: close, Ctrl-]: send Ctrl-]"
+
+// broadcastView tiles a shell per host. Keystrokes are sent to every attached
+// host, or only to the focused host when it is detached from broadcasting.
+type broadcastView struct {
+	*tview.Flex
+	app      *tview.Application
+	pages    *tview.Pages
+	help     *tview.TextView
+	hosts    []string
+	clients  []*cssh.Client
+	terms    []*terminalView
+	detached []bool
+	focused  int
+	prefix   bool // Ctrl-] was pressed
+	closed   bool
+}
+
+// grabKeys sends every key, Escape included, to the shells.
+func (v *broadcastView) grabKeys() {}
+
+func (v *broadcastView) Close() {
+	if v.closed {
+		return
+	}
+	v.closed = true
+	for i := range v.terms {
+		v.terms[i].Close()
+	}
+	connPool.PutMany(v.clients)
+}
+
+func broadcastShellOn(app *tview.Application, pages *tview.Pages, selectedConfigs []ssh.SSHConfig) {
+	clients, err := connPool.GetMany(selectedConfigs)
+	if err != nil {
+		connPool.PutMany(clients)
+		infoPopup(pages, err.Error())
+		return
+	}
+
+	v := &broadcastView{
+		Flex:     tview.NewFlex().SetDirection(tview.FlexRow),
+		app:      app,
+		pages:    pages,
+		clients:  clients,
+		detached: make([]bool, len(clients)),
+		help:     tview.NewTextView(),
+	}
+	for i := range selectedConfigs {
+		v.hosts = append(v.hosts, selectedConfigs[i].Host)
+		term, err := newTerminalView(app, selectedConfigs[i], clients[i], v.exited)
+		if err != nil {
+			v.Close()
+			infoPopup(pages, fmt.Sprintf("Error opening shell on Host %s: %v",
+				selectedConfigs[i].Host, err))
+			return
+		}
+		term.SetBorder(true)
+		v.terms = append(v.terms, term)
+	}
+
+	columns := int(math.Ceil(math.Sqrt(float64(len(v.terms)))))
+	rows := (len(v.terms) + columns - 1) / columns
+	grid := tview.NewGrid().
+		SetColumns(make([]int, columns)...).
+		SetRows(make([]int, rows)...)
+	for i, term := range v.terms {
+		grid.AddItem(term, i/columns, i%columns, 1, 1, 0, 0, i == 0)
+	}
+	v.AddItem(v.help, 1, 0, false).
+		AddItem(grid, 0, 1, true)
+	v.updateTitles()
+
+	v.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if v.prefix {
+			v.prefix = false
+			switch event.Rune() {
+			case 'n':
+				v.focus((v.focused + 1) % len(v.terms))
+			case 'p':
+				v.focus((v.focused + len(v.terms) - 1) % len(v.terms))
+			case 'b':
+				v.detached[v.focused] = !v.detached[v.focused]
+				v.updateTitles()
+			case 'q':
+				v.Close()
+				pages.RemovePage("broadcast")
+			}
+			if event.Key() == tcell.KeyCtrlRightSq {
+				v.broadcast(event)
+			}
+			return nil
+		}
+		if event.Key() == tcell.KeyCtrlRightSq {
+			v.prefix = true
+			return nil
+		}
+		v.broadcast(event)
+		return nil
+	})
+	pages.AddPage("broadcast", v, true, true)
+}
+
+// broadcast sends the key to the attached hosts, or only to the focused host
+// when it is detached.
+func (v *broadcastView) broadcast(event *tcell.EventKey) {
+	if v.detached[v.focused] {
+		v.terms[v.focused].sendKey(event)
+		return
+	}
+	for i := range v.terms {
+		if !v.detached[i] {
+			v.terms[i].sendKey(event)
+		}
+	}
+}
+
+func (v *broadcastView) focus(i int) {
+	v.focused = i
+	v.app.SetFocus(v.terms[i])
+	v.updateTitles()
+}
+
+func (v *broadcastView) updateTitles() {
+	attached := 0
+	for i, term := range v.terms {
+		var state []string
+		if v.detached[i] {
+			state = append(state, "detached")
+		} else {
+			attached++
+		}
+		if term.exited.Load() {
+			state = append(state, "exited")
+		}
+		title := " " + v.hosts[i] + " "
+		if len(state) != 0 {
+			title = fmt.Sprintf(" %s [%s] ", v.hosts[i], strings.Join(state, ", "))
+		}
+		color := tview.Styles.BorderColor
+		if i == v.focused {
+			color = tcell.ColorYellow
+		}
+		term.SetTitle(tview.Escape(title)).SetBorderColor(color)
+	}
+	v.help.SetText(fmt.Sprintf("Broadcasting to %d/%d hosts. %s", attached, len(v.terms), broadcastHelp))
+}
+
+// exited is called from the shell goroutines, the page is closed once every
+// shell exited.
+func (v *broadcastView) exited() {
+	v.app.QueueUpdateDraw(func() {
+		if v.closed {
+			return
+		}
+		v.updateTitles()
+		for i := range v.terms {
+			if !v.terms[i].exited.Load() {
+				return
+			}
+		}
+		v.Close()
+		// another broadcast may have replaced this one meanwhile
+		if v.pages.GetPage("broadcast") == tview.Primitive(v) {
+			v.pages.RemovePage("broadcast")
+		}
+	})
+}
@@ -0,0 +1,227 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/noboruma/s1h/internal/ssh"
+	"github.com/rivo/tview"
+	cssh "golang.org/x/crypto/ssh"
+)
+
+type browserPane struct {
+	cfg     ssh.SSHConfig
+	client  *cssh.Client
+	cwd     string
+	entries []os.FileInfo
+	list    *tview.List
+}
+
+func newBrowserPane(cfg ssh.SSHConfig, client *cssh.Client) *browserPane {
+	list := tview.NewList().ShowSecondaryText(false)
+	list.SetBorder(true)
+	return &browserPane{
+		cfg:    cfg,
+		client: client,
+		list:   list,
+	}
+}
+
+func (p *browserPane) refresh() error {
+	cwd, entries, err := ssh.ListDir(p.client, p.cwd)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir() != entries[j].IsDir() {
+			return entries[i].IsDir()
+		}
+		return entries[i].Name() < entries[j].Name()
+	})
+	p.cwd = cwd
+	p.entries = entries
+
+	p.list.Clear()
+	p.list.AddItem("../", "", 0, nil)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		p.list.AddItem(name, "", 0, nil)
+	}
+	p.setTitle("")
+	return nil
+}
+
+func (p *browserPane) setTitle(status string) {
+	title := fmt.Sprintf(" %s:%s ", p.cfg.Host, p.cwd)
+	if status != "" {
+		title += fmt.Sprintf("(%s) ", status)
+	}
+	p.list.SetTitle(title)
+}
+
+// selected returns the highlighted entry, false when ".." is highlighted.
+func (p *browserPane) selected() (os.FileInfo, bool) {
+	index := p.list.GetCurrentItem()
+	if index <= 0 || index > len(p.entries) {
+		return nil, false
+	}
+	return p.entries[index-1], true
+}
+
+func browsePairPopup(app *tview.Application, pages *tview.Pages,
+	configs []ssh.SSHConfig, selectedConfig ssh.SSHConfig) {
+	hosts := make([]string, len(configs))
+	left, right := 0, 0
+	for i := range configs {
+		hosts[i] = configs[i].Host
+		if configs[i].Host == selectedConfig.Host {
+			left = i
+		}
+	}
+	// copying within a single host is still possible by picking it twice
+	right = (left + 1) % len(configs)
+	if len(multiSelectConfigs) >= 2 {
+		for i := range configs {
+			if configs[i].Host == multiSelectConfigs[0].Host {
+				left = i
+			}
+			if configs[i].Host == multiSelectConfigs[1].Host {
+				right = i
+			}
+		}
+	}
+
+	popup := tview.NewForm()
+	leftField := tview.NewDropDown().SetLabel("Left host: ").
+		SetOptions(hosts, nil).SetCurrentOption(left)
+	rightField := tview.NewDropDown().SetLabel("Right host: ").
+		SetOptions(hosts, nil).SetCurrentOption(right)
+	popup.AddFormItem(leftField)
+	popup.AddFormItem(rightField)
+	popup.AddButton("Browse", func() {
+		l, _ := leftField.GetCurrentOption()
+		r, _ := rightField.GetCurrentOption()
+		selectedConfigs := []ssh.SSHConfig{configs[l], configs[r]}
+		clients, err := connPool.GetMany(selectedConfigs)
+		pages.RemovePage("popup")
+		if err != nil {
+			connPool.PutMany(clients)
+			infoPopup(pages, err.Error())
+			return
+		}
+		browserPage(app, pages, selectedConfigs, clients)
+	})
+	popup.SetCancelFunc(func() {
+		pages.RemovePage("popup")
+	})
+	pages.AddPage("popup", popup, true, true)
+}
+
+// browserView hands its connections back to the pool once closed.
+type browserView struct {
+	*tview.Flex
+	clients []*cssh.Client
+}
+
+func (v *browserView) Close() {
+	connPool.PutMany(v.clients)
+}
+
+func browserPage(app *tview.Application, pages *tview.Pages,
+	selectedConfigs []ssh.SSHConfig, clients []*cssh.Client) {
+	panes := [2]*browserPane{
+		newBrowserPane(selectedConfigs[0], clients[0]),
+		newBrowserPane(selectedConfigs[1], clients[1]),
+	}
+	for _, pane := range panes {
+		if err := pane.refresh(); err != nil {
+			connPool.PutMany(clients)
+			infoPopup(pages, fmt.Sprintf("Error listing files on Host %s: %v",
+				pane.cfg.Host, err))
+			return
+		}
+	}
+
+	for i, pane := range panes {
+		other := panes[1-i]
+		pane.list.SetSelectedFunc(func(index int, _, _ string, _ rune) {
+			prev := pane.cwd
+			if index == 0 {
+				pane.cwd = path.Dir(pane.cwd)
+			} else if entry, ok := pane.selected(); ok && entry.IsDir() {
+				pane.cwd = path.Join(pane.cwd, entry.Name())
+			} else {
+				return
+			}
+			if err := pane.refresh(); err != nil {
+				pane.cwd = prev
+				infoPopup(pages, fmt.Sprintf("Error listing files on Host %s: %v",
+					pane.cfg.Host, err))
+			}
+		})
+		pane.list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			switch event.Key() {
+			case tcell.KeyTab, tcell.KeyBacktab:
+				app.SetFocus(other.list)
+				return nil
+			}
+			switch event.Rune() {
+			case 'c':
+				copyAcross(app, pages, pane, other)
+				return nil
+			case 'r':
+				if err := pane.refresh(); err != nil {
+					infoPopup(pages, fmt.Sprintf("Error listing files on Host %s: %v",
+						pane.cfg.Host, err))
+				}
+				return nil
+			}
+			return event
+		})
+	}
+
+	help := tview.NewTextView().
+		SetText("Enter: open dir | Tab: switch pane | c: copy to other pane | r: refresh | Esc: close").
+		SetTextColor(tcell.ColorYellow)
+	browser := &browserView{
+		Flex:    tview.NewFlex().SetDirection(tview.FlexRow),
+		clients: clients,
+	}
+	browser.AddItem(tview.NewFlex().
+		AddItem(panes[0].list, 0, 1, true).
+		AddItem(panes[1].list, 0, 1, false), 0, 1, true).
+		AddItem(help, 1, 0, false)
+	pages.AddPage("browser", browser, true, true)
+}
+
+// copyAcross streams the highlighted file of from into the current directory of to.
+func copyAcross(app *tview.Application, pages *tview.Pages, from, to *browserPane) {
+	entry, ok := from.selected()
+	if !ok || entry.IsDir() {
+		infoPopup(pages, "Please select a file to copy")
+		return
+	}
+	srcPath := path.Join(from.cwd, entry.Name())
+	dstPath := to.cwd
+	from.setTitle("copying " + entry.Name() + "...")
+	go func() {
+		err := ssh.CopyRemoteToRemote(from.client, to.client, srcPath, dstPath, nil)
+		app.QueueUpdateDraw(func() {
+			from.setTitle("")
+			if err != nil {
+				infoPopup(pages, fmt.Sprintf("Error copying %s:%s -> %s:%s: %v",
+					from.cfg.Host, srcPath, to.cfg.Host, dstPath, err))
+				return
+			}
+			_ = to.refresh()
+			infoPopup(pages, fmt.Sprintf("Successfully copied %s:%s -> %s:%s",
+				from.cfg.Host, srcPath, to.cfg.Host, dstPath))
+		})
+	}()
+}
@@ -0,0 +1,316 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/noboruma/s1h/internal/ssh"
+	"github.com/rivo/tview"
+)
+
+// dashboardInterval is how often the dashboard polls the hosts, overridden
+// by S1H_DASHBOARD_INTERVAL_SEC.
+var dashboardInterval = 5 * time.Second
+
+func init() {
+	customInterval := os.Getenv("S1H_DASHBOARD_INTERVAL_SEC")
+	if customInterval != "" {
+		n, err := strconv.Atoi(customInterval)
+		if err != nil {
+			log.Fatalf("S1H_DASHBOARD_INTERVAL_SEC wrong format: %v", err)
+		}
+		dashboardInterval = time.Duration(max(n, 1)) * time.Second
+	}
+}
+
+// historyLength is the number of samples drawn by the sparklines.
+const historyLength = 20
+
+// Dashboard columns, the sortable ones are selected with the keys 1 to 7.
+const (
+	dashHost = iota
+	dashCPU
+	dashCPUHistory
+	dashLoad
+	dashMem
+	dashMemHistory
+	dashDisk
+	dashRx
+	dashTx
+	dashError
+)
+
+var dashColumns = []string{"Host", "CPU", "CPU history", "Load", "Mem", "Mem history", "Disk", "Rx/s", "Tx/s", "Error"}
+
+var dashSortKeys = map[rune]int{
+	'1': dashHost,
+	'2': dashCPU,
+	'3': dashLoad,
+	'4': dashMem,
+	'5': dashDisk,
+	'6': dashRx,
+	'7': dashTx,
+}
+
+// hostMetrics holds the samples of a host.
+type hostMetrics struct {
+	host       string
+	last       ssh.MetricsSample
+	sampled    bool
+	cpu        float64
+	rx, tx     float64
+	cpuHistory []float64
+	memHistory []float64
+	err        error
+}
+
+func (m *hostMetrics) record(sample ssh.MetricsSample, err error) {
+	m.err = err
+	if err != nil {
+		return
+	}
+	if m.sampled {
+		m.cpu = sample.CPUPercent(m.last)
+		m.rx, m.tx = sample.NetRates(m.last)
+		m.cpuHistory = appendHistory(m.cpuHistory, m.cpu)
+	}
+	m.memHistory = appendHistory(m.memHistory, sample.MemPercent())
+	m.last, m.sampled = sample, true
+}
+
+func appendHistory(history []float64, value float64) []float64 {
+	history = append(history, value)
+	if len(history) > historyLength {
+		history = history[len(history)-historyLength:]
+	}
+	return history
+}
+
+// loadPercent is the load relative to the number of CPUs.
+func (m *hostMetrics) loadPercent() float64 {
+	return 100 * m.last.Load1 / float64(max(m.last.CPUs, 1))
+}
+
+// dashboardView shows the metrics of the reachable hosts, polled every
+// dashboardInterval until closed.
+type dashboardView struct {
+	*tview.Table
+	cancel     context.CancelFunc
+	metrics    map[string]*hostMetrics
+	sortColumn int
+	sortDesc   bool
+}
+
+func (v *dashboardView) Close() {
+	v.cancel()
+}
+
+func dashboardPage(app *tview.Application, pages *tview.Pages, configs []ssh.SSHConfig, probes *prober) {
+	ctx, cancel := context.WithCancel(context.Background())
+	v := &dashboardView{
+		Table: tview.NewTable().
+			SetBorders(false).
+			SetSelectable(true, false).
+			SetFixed(1, 0),
+		cancel:     cancel,
+		metrics:    make(map[string]*hostMetrics),
+		sortColumn: dashCPU,
+		sortDesc:   true,
+	}
+	v.SetBorder(true).SetTitle(fmt.Sprintf(" Dashboard, every %s (1-7: sort, Esc: close) ", dashboardInterval))
+	v.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		column, has := dashSortKeys[event.Rune()]
+		if !has {
+			return event
+		}
+		if v.sortColumn == column {
+			v.sortDesc = !v.sortDesc
+		} else {
+			// biggest consumers first
+			v.sortColumn, v.sortDesc = column, column != dashHost
+		}
+		v.fill()
+		return nil
+	})
+	v.fill()
+	pages.AddPage("dashboard", v, true, true)
+
+	go v.poll(ctx, app, configs, probes)
+}
+
+// poll samples the reachable hosts, at most ssh.DefaultParallelism at a
+// time, until ctx is cancelled.
+func (v *dashboardView) poll(ctx context.Context, app *tview.Application, configs []ssh.SSHConfig, probes *prober) {
+	sem := make(chan struct{}, ssh.DefaultParallelism)
+	for {
+		var wg sync.WaitGroup
+		for i, cfg := range configs {
+			if !probes.reachable(i) {
+				continue
+			}
+			wg.Add(1)
+			go func(cfg ssh.SSHConfig) {
+				defer wg.Done()
+				select {
+				case sem <- struct{}{}:
+					defer func() { <-sem }()
+				case <-ctx.Done():
+					return
+				}
+				sample, err := collectMetrics(ctx, cfg)
+				if ctx.Err() != nil {
+					return
+				}
+				app.QueueUpdateDraw(func() {
+					metrics, has := v.metrics[cfg.Host]
+					if !has {
+						metrics = &hostMetrics{host: cfg.Host}
+						v.metrics[cfg.Host] = metrics
+					}
+					metrics.record(sample, err)
+					v.fill()
+				})
+			}(cfg)
+		}
+		wg.Wait()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(dashboardInterval):
+		}
+	}
+}
+
+func collectMetrics(ctx context.Context, cfg ssh.SSHConfig) (ssh.MetricsSample, error) {
+	client, err := connPool.Get(cfg)
+	if err != nil {
+		return ssh.MetricsSample{}, err
+	}
+	defer connPool.Put(client)
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	return ssh.CollectMetrics(ctx, client)
+}
+
+// fill redraws the table, it must run on the UI goroutine.
+func (v *dashboardView) fill() {
+	row, _ := v.GetSelection()
+	v.Clear()
+	for col, name := range dashColumns {
+		if col == v.sortColumn {
+			if v.sortDesc {
+				name += " ▼"
+			} else {
+				name += " ▲"
+			}
+		}
+		v.SetCell(0, col, tview.NewTableCell(name).
+			SetTextColor(tcell.ColorYellow).
+			SetAlign(tview.AlignLeft).
+			SetSelectable(false))
+	}
+
+	rows := make([]*hostMetrics, 0, len(v.metrics))
+	for _, metrics := range v.metrics {
+		rows = append(rows, metrics)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if v.sortColumn != dashHost {
+			a, b := v.sortValue(rows[i]), v.sortValue(rows[j])
+			if a != b {
+				return a > b == v.sortDesc
+			}
+		} else if v.sortDesc {
+			return rows[i].host > rows[j].host
+		}
+		return rows[i].host < rows[j].host
+	})
+
+	for i, metrics := range rows {
+		cells := make([]*tview.TableCell, len(dashColumns))
+		for col := range cells {
+			cells[col] = tview.NewTableCell("").SetAlign(tview.AlignLeft)
+		}
+		cells[dashHost].SetText(metrics.host)
+		if metrics.err != nil {
+			cells[dashHost].SetTextColor(tcell.ColorDarkRed)
+			cells[dashError].SetText(metrics.err.Error()).SetTextColor(tcell.ColorDarkRed)
+		}
+		if metrics.sampled {
+			sample := metrics.last
+			if len(metrics.cpuHistory) > 0 {
+				setPercent(cells[dashCPU], metrics.cpu)
+				cells[dashCPUHistory].SetText(sparkline(metrics.cpuHistory)).
+					SetTextColor(levelColor(metrics.cpu))
+				cells[dashRx].SetText(ssh.FormatBytes(uint64(metrics.rx)) + "/s")
+				cells[dashTx].SetText(ssh.FormatBytes(uint64(metrics.tx)) + "/s")
+			}
+			cells[dashLoad].SetText(fmt.Sprintf("%.2f/%d", sample.Load1, sample.CPUs)).
+				SetTextColor(levelColor(metrics.loadPercent()))
+			setPercent(cells[dashMem], sample.MemPercent())
+			cells[dashMemHistory].SetText(sparkline(metrics.memHistory)).
+				SetTextColor(levelColor(sample.MemPercent()))
+			setPercent(cells[dashDisk], sample.DiskPercent())
+		}
+		for col, cell := range cells {
+			v.SetCell(i+1, col, cell)
+		}
+	}
+	if row < 1 {
+		row = 1
+	}
+	v.Select(min(row, max(len(rows), 1)), 0)
+}
+
+func (v *dashboardView) sortValue(m *hostMetrics) float64 {
+	switch v.sortColumn {
+	case dashCPU:
+		return m.cpu
+	case dashLoad:
+		return m.loadPercent()
+	case dashMem:
+		return m.last.MemPercent()
+	case dashDisk:
+		return m.last.DiskPercent()
+	case dashRx:
+		return m.rx
+	case dashTx:
+		return m.tx
+	}
+	return 0
+}
+
+func setPercent(cell *tview.TableCell, percent float64) {
+	cell.SetText(fmt.Sprintf("%.1f%%", percent)).SetTextColor(levelColor(percent))
+}
+
+// levelColor colors a usage percentage: green, yellow from 70%, red from 90%.
+func levelColor(percent float64) tcell.Color {
+	switch {
+	case percent >= 90:
+		return tcell.ColorRed
+	case percent >= 70:
+		return tcell.ColorYellow
+	}
+	return tcell.ColorGreen
+}
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws percentages as bars, one per value.
+func sparkline(values []float64) string {
+	var line strings.Builder
+	for _, value := range values {
+		i := int(value / 100 * float64(len(sparkBars)))
+		line.WriteRune(sparkBars[min(max(i, 0), len(sparkBars)-1)])
+	}
+	return line.String()
+}
@@ -0,0 +1,104 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/noboruma/s1h/internal/ssh"
+	"github.com/rivo/tview"
+	cssh "golang.org/x/crypto/ssh"
+)
+
+// closer is implemented by pages holding resources that must be released
+// when they are dismissed.
+type closer interface {
+	Close()
+}
+
+// outputView streams the output of a remote command.
+type outputView struct {
+	*tview.TextView
+	cancel context.CancelFunc
+}
+
+func (v *outputView) Close() {
+	v.cancel()
+}
+
+// execOutputPage runs command, fed with stdin when not nil, and streams its
+// output. label is how the command is presented to the user. The client is
+// handed back to the pool once the command is done.
+func execOutputPage(app *tview.Application, pages *tview.Pages,
+	host string, client *cssh.Client, label, command string, stdin []byte) {
+	ctx, cancel := context.WithCancel(context.Background())
+	view := &outputView{
+		TextView: tview.NewTextView().
+			SetDynamicColors(true).
+			SetScrollable(true).
+			SetChangedFunc(func() {
+				if !appSuspended.Load() {
+					app.Draw()
+				}
+			}),
+		cancel: cancel,
+	}
+	title := fmt.Sprintf(" %s: %s ", host, tview.Escape(label))
+	view.SetBorder(true).SetTitle(title + "(running, x: cancel) ")
+	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Rune() == 'x' {
+			cancel()
+			return nil
+		}
+		return event
+	})
+	pages.AddPage("output", view, true, true)
+
+	go func() {
+		defer connPool.Put(client)
+		start := time.Now()
+		var in io.Reader
+		if stdin != nil {
+			in = bytes.NewReader(stdin)
+		}
+		code, err := ssh.StreamCommand(ctx, client, command, in, func(line string, stderr bool) {
+			if stderr {
+				fmt.Fprintf(view, "[red]%s[-]\n", tview.Escape(line))
+			} else {
+				fmt.Fprintln(view, tview.Escape(line))
+			}
+		})
+		elapsed := time.Since(start).Round(time.Millisecond)
+		app.QueueUpdateDraw(func() {
+			switch {
+			case ctx.Err() != nil:
+				view.SetTitle(title + fmt.Sprintf("(cancelled after %s) ", elapsed))
+			case err != nil:
+				view.SetTitle(title + fmt.Sprintf("(error: %v) ", err))
+			case code != 0:
+				view.SetTitle(title + fmt.Sprintf("([red]exit %d[-] in %s) ", code, elapsed))
+			default:
+				view.SetTitle(title + fmt.Sprintf("([green]exit 0[-] in %s) ", elapsed))
+			}
+		})
+	}()
+}
+
+// scriptCommand returns the command to run for the exec popups. When a local
+// script is given, the command text holds the script arguments and the
+// script is fed over stdin.
+func scriptCommand(scriptPath, command string) (label, remoteCommand string, stdin []byte, err error) {
+	if strings.TrimSpace(scriptPath) == "" {
+		return command, command, nil, nil
+	}
+	script, err := ssh.LoadScript(scriptPath, strings.Fields(command))
+	if err != nil {
+		return "", "", nil, err
+	}
+	label = strings.TrimSpace(script.Name + " " + command)
+	return label, script.Command(), script.Content, nil
+}
@@ -0,0 +1,148 @@
+package tui
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/noboruma/s1h/internal/ssh"
+	"github.com/rivo/tview"
+)
+
+// Probe settings, overridden by S1H_PROBE_INTERVAL_SEC (0 disables the
+// periodic probes), S1H_PROBE_TIMEOUT_SEC, S1H_PROBE_PARALLELISM and
+// S1H_PROBE_AUTH (1 also authenticates, otherwise the probe stops at the
+// handshake not to pile up failed logins on the hosts).
+var (
+	probeInterval    = 2 * time.Minute
+	probeTimeout     = 10 * time.Second
+	probeParallelism = ssh.DefaultParallelism
+	probeAuth        = false
+)
+
+func init() {
+	for _, setting := range []struct {
+		name string
+		set  func(n int)
+	}{
+		{"S1H_PROBE_INTERVAL_SEC", func(n int) { probeInterval = time.Duration(n) * time.Second }},
+		{"S1H_PROBE_TIMEOUT_SEC", func(n int) { probeTimeout = time.Duration(n) * time.Second }},
+		{"S1H_PROBE_PARALLELISM", func(n int) { probeParallelism = max(n, 1) }},
+		{"S1H_PROBE_AUTH", func(n int) { probeAuth = n != 0 }},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			log.Fatalf("%s wrong format: %v", setting.name, err)
+		}
+		setting.set(n)
+	}
+}
+
+// prober probes the hosts periodically and on demand, at most parallelism
+// at a time, and shows the results in the host table.
+type prober struct {
+	app     *tview.Application
+	table   *tview.Table
+	configs []ssh.SSHConfig
+	results []atomic.Pointer[ssh.ProbeResult]
+	// queued avoids probing a host twice in a row, the queue then never
+	// holds more than one entry per host
+	queued []atomic.Bool
+	queue  chan int
+}
+
+func newProber(app *tview.Application, table *tview.Table, configs []ssh.SSHConfig) *prober {
+	return &prober{
+		app:     app,
+		table:   table,
+		configs: configs,
+		results: make([]atomic.Pointer[ssh.ProbeResult], len(configs)),
+		queued:  make([]atomic.Bool, len(configs)),
+		queue:   make(chan int, len(configs)),
+	}
+}
+
+// start runs the workers and, unless disabled, the periodic probes.
+func (p *prober) start() {
+	for range probeParallelism {
+		go p.work()
+	}
+	if probeInterval <= 0 {
+		return
+	}
+	go func() {
+		for ; ; <-time.After(probeInterval) {
+			for row := range p.configs {
+				p.enqueue(row)
+			}
+		}
+	}()
+}
+
+// refresh probes the host of row now, it must run on the UI goroutine.
+func (p *prober) refresh(row int) {
+	if p.enqueue(row) {
+		p.table.GetCell(row, 6).SetText("checking").SetTextColor(tcell.ColorGray)
+	}
+}
+
+func (p *prober) enqueue(row int) bool {
+	if p.queued[row].Swap(true) {
+		return false
+	}
+	p.queue <- row
+	return true
+}
+
+func (p *prober) work() {
+	for row := range p.queue {
+		res := ssh.Probe(p.configs[row], probeTimeout, probeAuth)
+		p.results[row].Store(&res)
+		p.queued[row].Store(false)
+		p.app.QueueUpdateDraw(func() {
+			showProbe(p.table, row, res)
+		})
+	}
+}
+
+// result returns the last probe of the host of row, nil until probed.
+func (p *prober) result(row int) *ssh.ProbeResult {
+	return p.results[row].Load()
+}
+
+// reachable tells whether the host of row answered its last probe. Hosts
+// are assumed reachable when the periodic probes are disabled and the host
+// was never probed.
+func (p *prober) reachable(row int) bool {
+	res := p.result(row)
+	if res == nil {
+		return probeInterval <= 0
+	}
+	return res.Reachable()
+}
+
+// showProbe displays the result of probing the host of row.
+func showProbe(table *tview.Table, row int, res ssh.ProbeResult) {
+	color := tcell.ColorDarkRed
+	switch res.Status {
+	case ssh.ProbeOK:
+		color = tcell.ColorDarkGreen
+	case ssh.ProbeAuthFailed, ssh.ProbeHostKeyMismatch, ssh.ProbeNoSSH:
+		color = tcell.ColorOrange
+	}
+	table.GetCell(row, 0).SetTextColor(color)
+	table.GetCell(row, 6).SetText(res.Status.String()).SetTextColor(color)
+	latency := ""
+	if res.Latency > 0 {
+		latency = res.Latency.Round(100 * time.Microsecond).String()
+	}
+	table.GetCell(row, 7).SetText(latency)
+	table.GetCell(row, 8).SetText(res.Checked.Format(time.TimeOnly))
+}
@@ -0,0 +1,259 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/noboruma/s1h/internal/ssh"
+	"github.com/rivo/tview"
+)
+
+const previewWidth = 80
+
+// resultsView lists the outcome of a command run on several hosts, filled in
+// as hosts complete. Enter shows the full output of a host, f toggles the
+// failed only filter and g groups hosts with identical output.
+type resultsView struct {
+	*tview.Table
+	cancel     context.CancelFunc
+	command    string
+	results    []ssh.ExecResult
+	done       []bool
+	status     string
+	failedOnly bool
+	grouped    bool
+	shown      []int
+	groups     []ssh.ResultGroup
+}
+
+func (v *resultsView) Close() {
+	v.cancel()
+}
+
+func resultsPage(pages *tview.Pages, command string, hosts []string,
+	cancel context.CancelFunc) *resultsView {
+	v := &resultsView{
+		Table: tview.NewTable().
+			SetBorders(false).
+			SetSelectable(true, false).
+			SetFixed(1, 0),
+		cancel:  cancel,
+		command: command,
+		results: make([]ssh.ExecResult, len(hosts)),
+		done:    make([]bool, len(hosts)),
+	}
+	for i := range hosts {
+		v.results[i].Host = hosts[i]
+	}
+	v.SetBorder(true)
+	v.fill()
+
+	v.SetSelectedFunc(func(row, column int) {
+		if v.grouped {
+			if row >= 1 && row <= len(v.groups) {
+				group := v.groups[row-1]
+				resultDetailPage(pages, command, ssh.FoldHosts(group.Hosts), group.Result)
+			}
+			return
+		}
+		if row < 1 || row > len(v.shown) {
+			return
+		}
+		i := v.shown[row-1]
+		if v.done[i] {
+			resultDetailPage(pages, command, v.results[i].Host, v.results[i])
+		}
+	})
+	v.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Rune() {
+		case 'f':
+			v.failedOnly = !v.failedOnly
+			v.fill()
+			v.Select(1, 0)
+			return nil
+		case 'g':
+			v.grouped = !v.grouped
+			v.fill()
+			v.Select(1, 0)
+			return nil
+		case 'x':
+			v.cancel()
+			return nil
+		}
+		return event
+	})
+	pages.AddPage("results", v, true, true)
+	return v
+}
+
+// update records the result of the i-th host, it must run on the UI goroutine.
+func (v *resultsView) update(i int, res ssh.ExecResult) {
+	v.results[i] = res
+	v.done[i] = true
+	v.fill()
+}
+
+// setStatus displays a run wide status, it must run on the UI goroutine.
+func (v *resultsView) setStatus(status string) {
+	v.status = status
+	v.fill()
+}
+
+func (v *resultsView) fill() {
+	row, _ := v.GetSelection()
+	v.Clear()
+	columns := []string{"Host", "Exit", "Duration", "Output"}
+	if v.grouped {
+		columns = []string{"Hosts", "Exit", "Count", "Output"}
+	}
+	for col, name := range columns {
+		v.SetCell(0, col, tview.NewTableCell(name).
+			SetTextColor(tcell.ColorYellow).
+			SetAlign(tview.AlignLeft).
+			SetSelectable(false))
+	}
+
+	v.shown = v.shown[:0]
+	succeeded, failed, timedOut, skipped, pending := 0, 0, 0, 0, 0
+	for i, res := range v.results {
+		switch {
+		case !v.done[i]:
+			pending++
+		case errors.Is(res.Err, ssh.ErrSkipped):
+			skipped++
+		case res.TimedOut:
+			timedOut++
+		case res.Failed():
+			failed++
+		default:
+			succeeded++
+		}
+		if v.failedOnly && (!v.done[i] || !res.Failed()) {
+			continue
+		}
+		v.shown = append(v.shown, i)
+	}
+
+	if v.grouped {
+		v.fillGroups()
+	} else {
+		v.fillHosts()
+	}
+
+	filter := "f: failed only"
+	if v.failedOnly {
+		filter = "f: show all"
+	}
+	status := fmt.Sprintf("%d ok, %d failed, %d timed out", succeeded, failed, timedOut)
+	if skipped != 0 {
+		status += fmt.Sprintf(", %d skipped", skipped)
+	}
+	if pending != 0 {
+		status += fmt.Sprintf(", %d pending (x: cancel)", pending)
+	}
+	if v.status != "" {
+		status += ", " + tview.Escape(v.status)
+	}
+	group := "g: group identical"
+	if v.grouped {
+		group = "g: per host"
+	}
+	v.SetTitle(fmt.Sprintf(" %s: %s (Enter: details, %s, %s) ",
+		tview.Escape(v.command), status, filter, group))
+	if row < 1 {
+		row = 1
+	}
+	v.Select(row, 0)
+}
+
+func (v *resultsView) fillHosts() {
+	for r, i := range v.shown {
+		res := v.results[i]
+		color, exit, duration := tcell.ColorDarkGreen, strconv.Itoa(res.ExitCode), res.Duration.Round(time.Millisecond).String()
+		switch {
+		case !v.done[i]:
+			color, exit, duration = tcell.ColorDefault, "...", "pending"
+		case errors.Is(res.Err, ssh.ErrSkipped):
+			color, exit, duration = tcell.ColorGray, "skipped", ""
+		case res.TimedOut:
+			color, exit = tcell.ColorYellow, "timeout"
+		case res.Failed():
+			color = tcell.ColorDarkRed
+		}
+		v.SetCell(r+1, 0, tview.NewTableCell(tview.Escape(res.Host)).
+			SetTextColor(color).
+			SetAlign(tview.AlignLeft))
+		v.SetCell(r+1, 1, tview.NewTableCell(exit).
+			SetAlign(tview.AlignLeft))
+		v.SetCell(r+1, 2, tview.NewTableCell(duration).
+			SetAlign(tview.AlignLeft))
+		v.SetCell(r+1, 3, tview.NewTableCell(tview.Escape(preview(res))).
+			SetAlign(tview.AlignLeft))
+	}
+}
+
+// fillGroups lists completed hosts collapsed by identical output.
+func (v *resultsView) fillGroups() {
+	var completed []ssh.ExecResult
+	for _, i := range v.shown {
+		if v.done[i] {
+			completed = append(completed, v.results[i])
+		}
+	}
+	v.groups = ssh.GroupResults(completed)
+	for r, group := range v.groups {
+		res := group.Result
+		color, exit := tcell.ColorDarkGreen, strconv.Itoa(res.ExitCode)
+		switch {
+		case res.TimedOut:
+			color, exit = tcell.ColorYellow, "timeout"
+		case res.Failed():
+			color = tcell.ColorDarkRed
+		}
+		v.SetCell(r+1, 0, tview.NewTableCell(tview.Escape(ssh.FoldHosts(group.Hosts))).
+			SetTextColor(color).
+			SetAlign(tview.AlignLeft))
+		v.SetCell(r+1, 1, tview.NewTableCell(exit).
+			SetAlign(tview.AlignLeft))
+		v.SetCell(r+1, 2, tview.NewTableCell(fmt.Sprintf("%d hosts", len(group.Hosts))).
+			SetAlign(tview.AlignLeft))
+		v.SetCell(r+1, 3, tview.NewTableCell(tview.Escape(preview(res))).
+			SetAlign(tview.AlignLeft))
+	}
+}
+
+func resultDetailPage(pages *tview.Pages, command, hosts string, res ssh.ExecResult) {
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+	if res.Err != nil {
+		fmt.Fprintf(view, "[red]%s[-]\n", tview.Escape(res.Err.Error()))
+	}
+	fmt.Fprint(view, tview.Escape(string(res.Stdout)))
+	if len(res.Stderr) != 0 {
+		fmt.Fprintf(view, "[red]%s[-]", tview.Escape(string(res.Stderr)))
+	}
+	view.SetBorder(true).SetTitle(fmt.Sprintf(" %s: %s (exit %d in %s) ",
+		tview.Escape(hosts), tview.Escape(command), res.ExitCode, res.Duration.Round(time.Millisecond)))
+	pages.AddPage("detail", view, true, true)
+}
+
+// preview returns the first line of output, favouring stderr on failure.
+func preview(res ssh.ExecResult) string {
+	out := res.Stdout
+	if res.Err != nil {
+		out = []byte(res.Err.Error())
+	} else if res.Failed() && len(res.Stderr) != 0 || len(out) == 0 {
+		out = res.Stderr
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if len(line) > previewWidth {
+		line = line[:previewWidth] + "..."
+	}
+	return line
+}
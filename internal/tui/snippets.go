@@ -0,0 +1,102 @@
+package tui
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/noboruma/s1h/internal/ssh"
+	"github.com/rivo/tview"
+)
+
+// fuzzyScore reports whether the letters of pattern appear in order in text.
+// Lower scores are better matches.
+func fuzzyScore(pattern, text string) (int, bool) {
+	pattern, text = strings.ToLower(pattern), strings.ToLower(text)
+	score, last := 0, -1
+	for _, r := range pattern {
+		n := strings.IndexRune(text[last+1:], r)
+		if n == -1 {
+			return 0, false
+		}
+		score += n // gaps between matched letters
+		last += n + 1
+	}
+	return score, true
+}
+
+// commandAutocomplete suggests snippets on "@" and local paths otherwise.
+func commandAutocomplete(currentText string) []string {
+	pattern, isSnippet := strings.CutPrefix(currentText, "@")
+	if !isSnippet {
+		return DirAutocomplete(currentText)
+	}
+	if strings.ContainsRune(pattern, ' ') {
+		return nil
+	}
+	type match struct {
+		name  string
+		score int
+	}
+	var matches []match
+	for _, snippet := range ssh.GetSnippets() {
+		if score, ok := fuzzyScore(pattern, snippet.Name); ok {
+			matches = append(matches, match{snippet.Name, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score < matches[j].score
+	})
+	res := make([]string, len(matches))
+	for i := range matches {
+		res[i] = "@" + matches[i].name
+	}
+	return res
+}
+
+// withSnippet calls run with the command text, expanding "@name key=value..."
+// snippet calls first. Placeholders without a value are asked through a form.
+func withSnippet(pages *tview.Pages, text string, run func(command string)) {
+	snippet, values, ok, err := ssh.ParseSnippetCall(strings.Fields(text))
+	if err != nil {
+		infoPopup(pages, err.Error())
+		return
+	}
+	if !ok {
+		run(text)
+		return
+	}
+	command, err := snippet.Expand(values)
+	if err == nil {
+		run(command)
+		return
+	}
+
+	popup := tview.NewForm()
+	placeholders := snippet.Placeholders()
+	fields := make([]*tview.InputField, len(placeholders))
+	for i, placeholder := range placeholders {
+		value := values[placeholder.Name]
+		if value == "" {
+			value = placeholder.Default
+		}
+		fields[i] = tview.NewInputField().SetFieldWidth(256).SetText(value)
+		fields[i].SetLabel(placeholder.Name + ": ")
+		popup.AddFormItem(fields[i])
+	}
+	popup.AddButton("Run", func() {
+		for i, placeholder := range placeholders {
+			values[placeholder.Name] = fields[i].GetText()
+		}
+		command, err := snippet.Expand(values)
+		if err != nil {
+			infoPopup(pages, err.Error())
+			return
+		}
+		run(command)
+	})
+	popup.SetCancelFunc(func() {
+		pages.RemovePage("popup")
+	})
+	popup.SetBorder(true).SetTitle(" @" + snippet.Name + ": " + tview.Escape(snippet.Command) + " ")
+	pages.AddPage("popup", popup, true, true)
+}
@@ -0,0 +1,193 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/noboruma/s1h/internal/ssh"
+	"github.com/rivo/tview"
+	cssh "golang.org/x/crypto/ssh"
+)
+
+const tabsHelp = "Ctrl-] then n/p: next/previous tab, 1-9: go to tab, h: back to hosts, x: close tab"
+
+type shellTab struct {
+	id     int
+	host   string
+	client *cssh.Client
+	term   *terminalView
+}
+
+// terminalTabs holds the shells opened with s, one tab per session. Shells
+// keep running while the host table is displayed.
+type terminalTabs struct {
+	*tview.Flex
+	app     *tview.Application
+	pages   *tview.Pages
+	bar     *tview.TextView
+	views   *tview.Pages
+	tabs    []*shellTab
+	current int
+	prefix  bool // Ctrl-] was pressed
+	lastID  int
+}
+
+// grabKeys sends every key, Escape included, to the shells.
+func (v *terminalTabs) grabKeys() {}
+
+func newTerminalTabs(app *tview.Application, pages *tview.Pages) *terminalTabs {
+	v := &terminalTabs{
+		Flex:  tview.NewFlex().SetDirection(tview.FlexRow),
+		app:   app,
+		pages: pages,
+		bar:   tview.NewTextView().SetDynamicColors(true),
+		views: tview.NewPages(),
+	}
+	v.AddItem(v.bar, 1, 0, false).
+		AddItem(v.views, 0, 1, true)
+
+	v.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if len(v.tabs) == 0 {
+			return nil
+		}
+		if !v.prefix {
+			switch {
+			case event.Key() == tcell.KeyCtrlRightSq:
+				v.prefix = true
+			case v.tabs[v.current].term.exited.Load():
+				v.closeTab(v.tabs[v.current])
+			default:
+				v.tabs[v.current].term.sendKey(event)
+			}
+			return nil
+		}
+		v.prefix = false
+		switch r := event.Rune(); {
+		case r == 'n':
+			v.switchTo((v.current + 1) % len(v.tabs))
+		case r == 'p':
+			v.switchTo((v.current + len(v.tabs) - 1) % len(v.tabs))
+		case r >= '1' && r <= '9':
+			if i := int(r - '1'); i < len(v.tabs) {
+				v.switchTo(i)
+			}
+		case r == 'h':
+			v.hide()
+		case r == 'x':
+			v.closeTab(v.tabs[v.current])
+		case event.Key() == tcell.KeyCtrlRightSq:
+			v.tabs[v.current].term.sendKey(event)
+		}
+		return nil
+	})
+	pages.AddPage("terminals", v, true, false)
+	return v
+}
+
+// open starts a shell on the host in a new tab and displays it.
+func (v *terminalTabs) open(cfg ssh.SSHConfig) {
+	client, err := connPool.Get(cfg)
+	if err != nil {
+		infoPopup(v.pages, fmt.Sprintf("Error accessing ssh for Host %s: %v",
+			cfg.Host, err))
+		return
+	}
+	v.lastID++
+	tab := &shellTab{id: v.lastID, host: cfg.Host, client: client}
+	tab.term, err = newTerminalView(v.app, cfg, client, func() {
+		v.app.QueueUpdateDraw(func() {
+			if cfg.RemoteCommand != "" || ssh.ConnectionLost(client) != nil {
+				v.updateBar() // keep the output until a key is pressed
+				return
+			}
+			v.closeTab(tab)
+		})
+	})
+	if err != nil {
+		connPool.Put(client)
+		infoPopup(v.pages, fmt.Sprintf("Error opening shell on Host %s: %v",
+			cfg.Host, err))
+		return
+	}
+	v.tabs = append(v.tabs, tab)
+	v.views.AddPage(v.pageName(tab), tab.term, true, false)
+	v.switchTo(len(v.tabs) - 1)
+	v.show()
+}
+
+// show brings the tabs in front of the host table, it reports whether there
+// is any tab to show.
+func (v *terminalTabs) show() bool {
+	if len(v.tabs) == 0 {
+		return false
+	}
+	v.pages.ShowPage("terminals")
+	v.pages.SendToFront("terminals")
+	v.app.SetFocus(v.tabs[v.current].term)
+	return true
+}
+
+func (v *terminalTabs) hide() {
+	v.pages.HidePage("terminals")
+}
+
+func (v *terminalTabs) switchTo(i int) {
+	v.current = i
+	v.views.SwitchToPage(v.pageName(v.tabs[i]))
+	if name, _ := v.pages.GetFrontPage(); name == "terminals" {
+		v.app.SetFocus(v.tabs[i].term)
+	}
+	v.updateBar()
+}
+
+func (v *terminalTabs) closeTab(tab *shellTab) {
+	i := -1
+	for j := range v.tabs {
+		if v.tabs[j] == tab {
+			i = j
+		}
+	}
+	if i == -1 { // already closed
+		return
+	}
+	tab.term.Close()
+	connPool.Put(tab.client)
+	if v.views.GetPage(v.pageName(tab)) == tview.Primitive(tab.term) {
+		v.views.RemovePage(v.pageName(tab))
+	}
+	v.tabs = append(v.tabs[:i], v.tabs[i+1:]...)
+	if len(v.tabs) == 0 {
+		v.current = 0
+		v.hide()
+		return
+	}
+	if v.current >= len(v.tabs) || v.current > i {
+		v.current--
+	}
+	v.switchTo(max(v.current, 0))
+}
+
+func (v *terminalTabs) pageName(tab *shellTab) string {
+	return fmt.Sprintf("tab-%d", tab.id) // never reused, unlike addresses
+}
+
+func (v *terminalTabs) updateBar() {
+	var bar strings.Builder
+	for i, tab := range v.tabs {
+		label := fmt.Sprintf(" %d:%s ", i+1, tab.host)
+		if ssh.ConnectionLost(tab.client) != nil {
+			label = fmt.Sprintf(" %d:%s [connection lost, press a key to close] ", i+1, tab.host)
+		} else if tab.term.exited.Load() {
+			label = fmt.Sprintf(" %d:%s [exited, press a key to close] ", i+1, tab.host)
+		}
+		name := tview.Escape(label)
+		if i == v.current {
+			fmt.Fprintf(&bar, "[black:yellow]%s[-:-] ", name)
+		} else {
+			fmt.Fprintf(&bar, "%s ", name)
+		}
+	}
+	bar.WriteString(" " + tabsHelp)
+	v.bar.SetText(bar.String())
+}
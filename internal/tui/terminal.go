@@ -0,0 +1,259 @@
+package tui
+
+import (
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/hinshun/vt10x"
+	"github.com/noboruma/s1h/internal/ssh"
+	"github.com/rivo/tview"
+	cssh "golang.org/x/crypto/ssh"
+)
+
+// Glyph attributes of vt10x, they are not exported.
+const (
+	vtReverse = 1 << iota
+	vtUnderline
+	vtBold
+	_ // gfx
+	vtItalic
+	vtBlink
+)
+
+// terminalView renders a remote shell through a terminal emulator.
+type terminalView struct {
+	*tview.Box
+	app *tview.Application
+	vt  vt10x.Terminal
+	rec *ssh.Recorder // nil when not recording
+	// shell is set once opened, the output goroutine may reply to it before
+	shell atomic.Pointer[ssh.ShellSession]
+
+	mu      sync.Mutex
+	partial []byte // incomplete UTF-8 sequence of the last write
+
+	cols, rows int
+	exited     atomic.Bool
+	onExit     func()
+}
+
+var recordDir string
+
+// SetRecordDir records every shell opened from the TUI in dir, an empty dir
+// disables recording.
+func SetRecordDir(dir string) {
+	recordDir = dir
+}
+
+// newTerminalView opens a shell, or the RemoteCommand of the host, on client.
+// onExit, when set, is called from the reading goroutine once the shell exits.
+func newTerminalView(app *tview.Application, cfg ssh.SSHConfig, client *cssh.Client, onExit func()) (*terminalView, error) {
+	t := &terminalView{
+		Box:    tview.NewBox(),
+		app:    app,
+		cols:   80,
+		rows:   24,
+		onExit: onExit,
+	}
+	var err error
+	if recordDir != "" {
+		t.rec, err = ssh.NewRecorder(recordDir, cfg.Host, t.cols, t.rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.vt = vt10x.New(vt10x.WithSize(t.cols, t.rows), vt10x.WithWriter(shellWriter{t}))
+	shell, err := ssh.OpenShell(client, cfg.RemoteCommand, cfg.WantsTTY(true), t.cols, t.rows, t)
+	if err != nil {
+		if t.rec != nil {
+			t.rec.Close()
+		}
+		return nil, err
+	}
+	t.shell.Store(shell)
+	go func() {
+		_ = shell.Wait()
+		if t.rec != nil {
+			t.rec.Close()
+		}
+		t.exited.Store(true)
+		if t.onExit != nil {
+			t.onExit()
+		}
+		t.redraw()
+	}()
+	return t, nil
+}
+
+// shellWriter sends the terminal replies, e.g. cursor position reports, back
+// to the shell.
+type shellWriter struct {
+	t *terminalView
+}
+
+func (w shellWriter) Write(p []byte) (int, error) {
+	shell := w.t.shell.Load()
+	if shell == nil {
+		return len(p), nil
+	}
+	return shell.Write(p)
+}
+
+// Write feeds the shell output to the terminal emulator.
+func (t *terminalView) Write(p []byte) (int, error) {
+	if t.rec != nil {
+		_, _ = t.rec.Write(p)
+	}
+	t.mu.Lock()
+	buf := append(t.partial, p...)
+	n, err := t.vt.Write(buf)
+	t.partial = append([]byte(nil), buf[n:]...)
+	t.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	t.redraw()
+	return len(p), nil
+}
+
+func (t *terminalView) redraw() {
+	if !appSuspended.Load() {
+		t.app.QueueUpdateDraw(func() {})
+	}
+}
+
+func (t *terminalView) Close() {
+	_ = t.shell.Load().Close()
+}
+
+func (t *terminalView) Draw(screen tcell.Screen) {
+	t.Box.DrawForSubclass(screen, t)
+	x, y, width, height := t.GetInnerRect()
+	if width <= 0 || height <= 0 {
+		return
+	}
+	if width != t.cols || height != t.rows {
+		t.cols, t.rows = width, height
+		t.vt.Resize(width, height)
+		_ = t.shell.Load().Resize(width, height)
+		if t.rec != nil {
+			_ = t.rec.Resize(width, height)
+		}
+	}
+
+	t.vt.Lock()
+	defer t.vt.Unlock()
+	for row := 0; row < height; row++ {
+		for col := 0; col < width; col++ {
+			glyph := t.vt.Cell(col, row)
+			char := glyph.Char
+			if char == 0 {
+				char = ' '
+			}
+			screen.SetContent(x+col, y+row, char, nil, glyphStyle(glyph))
+		}
+	}
+	if t.HasFocus() && t.vt.CursorVisible() && !t.exited.Load() {
+		cursor := t.vt.Cursor()
+		if cursor.X < width && cursor.Y < height {
+			screen.ShowCursor(x+cursor.X, y+cursor.Y)
+		}
+	}
+}
+
+func glyphStyle(glyph vt10x.Glyph) tcell.Style {
+	style := tcell.StyleDefault.
+		Foreground(vtColor(glyph.FG)).
+		Background(vtColor(glyph.BG)).
+		Reverse(glyph.Mode&vtReverse != 0).
+		Underline(glyph.Mode&vtUnderline != 0).
+		Bold(glyph.Mode&vtBold != 0).
+		Italic(glyph.Mode&vtItalic != 0).
+		Blink(glyph.Mode&vtBlink != 0)
+	return style
+}
+
+func vtColor(c vt10x.Color) tcell.Color {
+	if c >= 256 {
+		return tcell.ColorDefault
+	}
+	return tcell.PaletteColor(int(c))
+}
+
+// sendKey forwards a key press to the shell.
+func (t *terminalView) sendKey(event *tcell.EventKey) {
+	if t.exited.Load() {
+		return
+	}
+	appCursor := t.vt.Mode()&vt10x.ModeAppCursor != 0
+	if b := keyBytes(event, appCursor); len(b) != 0 {
+		_, _ = t.shell.Load().Write(b)
+	}
+}
+
+// keyBytes translates a key press to what an xterm sends.
+func keyBytes(event *tcell.EventKey, appCursor bool) []byte {
+	var b []byte
+	switch key := event.Key(); key {
+	case tcell.KeyRune:
+		b = utf8.AppendRune(nil, event.Rune())
+	case tcell.KeyUp, tcell.KeyDown, tcell.KeyRight, tcell.KeyLeft:
+		final := map[tcell.Key]byte{
+			tcell.KeyUp:    'A',
+			tcell.KeyDown:  'B',
+			tcell.KeyRight: 'C',
+			tcell.KeyLeft:  'D',
+		}[key]
+		if appCursor {
+			return []byte{0x1b, 'O', final}
+		}
+		b = []byte{0x1b, '[', final}
+	case tcell.KeyHome:
+		b = []byte("\x1b[H")
+	case tcell.KeyEnd:
+		b = []byte("\x1b[F")
+	case tcell.KeyInsert:
+		b = []byte("\x1b[2~")
+	case tcell.KeyDelete:
+		b = []byte("\x1b[3~")
+	case tcell.KeyPgUp:
+		b = []byte("\x1b[5~")
+	case tcell.KeyPgDn:
+		b = []byte("\x1b[6~")
+	case tcell.KeyBacktab:
+		b = []byte("\x1b[Z")
+	case tcell.KeyF1, tcell.KeyF2, tcell.KeyF3, tcell.KeyF4:
+		b = []byte{0x1b, 'O', byte('P' + key - tcell.KeyF1)}
+	case tcell.KeyF5:
+		b = []byte("\x1b[15~")
+	case tcell.KeyF6:
+		b = []byte("\x1b[17~")
+	case tcell.KeyF7:
+		b = []byte("\x1b[18~")
+	case tcell.KeyF8:
+		b = []byte("\x1b[19~")
+	case tcell.KeyF9:
+		b = []byte("\x1b[20~")
+	case tcell.KeyF10:
+		b = []byte("\x1b[21~")
+	case tcell.KeyF11:
+		b = []byte("\x1b[23~")
+	case tcell.KeyF12:
+		b = []byte("\x1b[24~")
+	case tcell.KeyBackspace, tcell.KeyDEL:
+		b = []byte{0x7f}
+	default:
+		switch {
+		case key >= tcell.KeyCtrlSpace && key <= tcell.KeyCtrlUnderscore:
+			b = []byte{byte(key - tcell.KeyCtrlSpace)}
+		case key < 0x20: // Tab, Enter, Escape...
+			b = []byte{byte(key)}
+		}
+	}
+	if len(b) != 0 && event.Modifiers()&tcell.ModAlt != 0 {
+		b = append([]byte{0x1b}, b...)
+	}
+	return b
+}
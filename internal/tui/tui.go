@@ -1,6 +1,8 @@
 package tui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -18,6 +20,7 @@ var (
 	autoCompleteHostNames []string
 	autoCompleteHosts     []string
 	multiSelectConfigs    []ssh.SSHConfig
+	connPool              *ssh.Pool
 )
 
 func PopulateAutocompleteCaches(configs []ssh.SSHConfig) {
@@ -30,17 +33,20 @@ func PopulateAutocompleteCaches(configs []ssh.SSHConfig) {
 func DisplaySSHConfig(configs []ssh.SSHConfig) {
 	app := tview.NewApplication()
 
-	sshOutput := tview.NewTextView().
-		SetText("Connecting...\n").
-		SetTextAlign(tview.AlignLeft).
-		SetDynamicColors(true)
-
-	sshPage := tview.NewFlex().
-		SetDirection(tview.FlexRow).
-		SetFullScreen(true).
-		AddItem(sshOutput, 0, 1, false)
-
 	pages := tview.NewPages()
+	tabs := newTerminalTabs(app, pages)
+	ssh.SetConnectionLostHandler(func(host string, err error) {
+		app.QueueUpdateDraw(func() {
+			infoPopup(pages, err.Error())
+		})
+	})
+	ssh.SetEnvRejectedHandler(func(host string, names []string) {
+		// sessions may be opened from the event loop
+		go app.QueueUpdateDraw(func() {
+			infoPopup(pages, fmt.Sprintf("%s refused the environment variables %s, see AcceptEnv in its sshd_config",
+				host, strings.Join(names, ", ")))
+		})
+	})
 	root := tview.NewFlex().SetDirection(tview.FlexRow)
 
 	header := tview.NewTable()
@@ -68,7 +74,7 @@ func DisplaySSHConfig(configs []ssh.SSHConfig) {
 		SetTextColor(tcell.ColorYellow).
 		SetAlign(tview.AlignLeft).
 		SetSelectable(false))
-	header.SetCell(3, 1, tview.NewTableCell("Shell to selected host").
+	header.SetCell(3, 1, tview.NewTableCell("Shell to selected host in a new tab, or broadcast shell to multi selected hosts").
 		SetTextColor(tcell.ColorPurple).
 		SetAlign(tview.AlignLeft).
 		SetSelectable(false))
@@ -96,8 +102,59 @@ func DisplaySSHConfig(configs []ssh.SSHConfig) {
 		SetTextColor(tcell.ColorPurple).
 		SetAlign(tview.AlignLeft).
 		SetSelectable(false))
+	header.SetCell(7, 0, tview.NewTableCell("b:").
+		SetTextColor(tcell.ColorYellow).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+	header.SetCell(7, 1, tview.NewTableCell("Browse & copy files between two hosts").
+		SetTextColor(tcell.ColorPurple).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+
+	header.SetCell(8, 0, tview.NewTableCell("E:").
+		SetTextColor(tcell.ColorYellow).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+	header.SetCell(8, 1, tview.NewTableCell("Edit remote file in local $EDITOR").
+		SetTextColor(tcell.ColorPurple).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+	header.SetCell(9, 0, tview.NewTableCell("t:").
+		SetTextColor(tcell.ColorYellow).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+	header.SetCell(9, 1, tview.NewTableCell("Show shell tabs").
+		SetTextColor(tcell.ColorPurple).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+	header.SetCell(10, 0, tview.NewTableCell("i:").
+		SetTextColor(tcell.ColorYellow).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+	header.SetCell(10, 1, tview.NewTableCell("Show host details").
+		SetTextColor(tcell.ColorPurple).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+
+	header.SetCell(11, 0, tview.NewTableCell("r/R:").
+		SetTextColor(tcell.ColorYellow).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+	header.SetCell(11, 1, tview.NewTableCell("Refresh the status of the selected/all hosts").
+		SetTextColor(tcell.ColorPurple).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
 
-	root.AddItem(header, 7, 2, false)
+	header.SetCell(12, 0, tview.NewTableCell("D:").
+		SetTextColor(tcell.ColorYellow).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+	header.SetCell(12, 1, tview.NewTableCell("Show the fleet metrics dashboard").
+		SetTextColor(tcell.ColorPurple).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+
+	root.AddItem(header, 13, 2, false)
 
 	tableHeader := tview.NewTable().
 		SetSeparator('|').
@@ -124,6 +181,22 @@ func DisplaySSHConfig(configs []ssh.SSHConfig) {
 		SetTextColor(tcell.ColorBlue).
 		SetAlign(tview.AlignLeft).
 		SetSelectable(false))
+	tableHeader.SetCell(0, 5, tview.NewTableCell("Conn").
+		SetTextColor(tcell.ColorGreen).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+	tableHeader.SetCell(0, 6, tview.NewTableCell("Status").
+		SetTextColor(tcell.ColorYellow).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+	tableHeader.SetCell(0, 7, tview.NewTableCell("Latency").
+		SetTextColor(tcell.ColorBlueViolet).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
+	tableHeader.SetCell(0, 8, tview.NewTableCell("Checked").
+		SetTextColor(tcell.ColorBlue).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false))
 
 	root.AddItem(tableHeader, 1, 5, false)
 
@@ -133,8 +206,9 @@ func DisplaySSHConfig(configs []ssh.SSHConfig) {
 		SetBorders(false).
 		SetSelectable(true, false)
 
-	reachables := make([]atomic.Bool, len(configs))
+	rows := make(map[string]int, len(configs))
 	for i, config := range configs {
+		rows[config.Host] = i
 		table.SetCell(i, 0, tview.NewTableCell(config.Host).
 			SetAlign(tview.AlignLeft))
 		table.SetCell(i, 1, tview.NewTableCell(config.HostName).
@@ -153,9 +227,29 @@ func DisplaySSHConfig(configs []ssh.SSHConfig) {
 			table.SetCell(i, 4, tview.NewTableCell("All").
 				SetAlign(tview.AlignLeft))
 		}
+		table.SetCell(i, 5, tview.NewTableCell("").
+			SetTextColor(tcell.ColorGreen).
+			SetAlign(tview.AlignLeft))
+		for column := 6; column <= 8; column++ {
+			table.SetCell(i, column, tview.NewTableCell("").
+				SetAlign(tview.AlignLeft))
+		}
 	}
 
-	go reachabilityCheck(configs, reachables, table, app)
+	connPool = ssh.NewPool(func(host string) {
+		// also called from the event loop, e.g. when connecting for a popup
+		go app.QueueUpdateDraw(func() {
+			text := ""
+			if connPool.Connected(host) {
+				text = "connected"
+			}
+			table.GetCell(rows[host], 5).SetText(text)
+		})
+	})
+	defer connPool.Close()
+
+	probes := newProber(app, table, configs)
+	probes.start()
 
 	//table.SetSelectedFunc(func(row, column int) {
 	//	selectedConfig := configs[row]
@@ -172,11 +266,23 @@ func DisplaySSHConfig(configs []ssh.SSHConfig) {
 	//})
 
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if _, item := pages.GetFrontPage(); item != nil {
+			if _, ok := item.(keyGrabber); ok {
+				if event.Key() == tcell.KeyCtrlC { // not to stop the app
+					return tcell.NewEventKey(event.Key(), event.Rune(), event.Modifiers())
+				}
+				return event
+			}
+		}
 		defer app.Sync()
 		switch event.Key() {
 		case tcell.KeyEscape:
-			if pages.HasPage("popup") {
-				pages.RemovePage("popup")
+			if overlayShown(pages) {
+				name, item := pages.GetFrontPage()
+				if c, ok := item.(closer); ok {
+					c.Close()
+				}
+				pages.RemovePage(name)
 			} else {
 				app.Stop()
 			}
@@ -193,33 +299,36 @@ func DisplaySSHConfig(configs []ssh.SSHConfig) {
 		}
 		switch event.Rune() {
 		case 'q':
-			if !pages.HasPage("popup") {
+			if !overlayShown(pages) {
 				app.Stop()
 			}
 		case 's': // shell into
-			if pages.HasPage("popup") {
+			if overlayShown(pages) {
 				return event
 			}
+			if len(multiSelectConfigs) != 0 {
+				broadcastShellOn(app, pages, multiSelectConfigs)
+				return nil
+			}
 			row, _ := table.GetSelection()
-			selectedConfig := configs[row]
-			pages.AddPage("popup", sshPage, true, true)
-			app.Suspend(func() {
-				appSuspended.Store(true)
-				defer appSuspended.Store(false)
-				err := ssh.ExecuteSSHShell(selectedConfig)
-				pages.RemovePage("popup")
-				if err != nil {
-					infoPopup(pages, fmt.Sprintf("Error accessing ssh for Host %s: %v",
-						selectedConfig.Host, err))
-				}
-			})
+			tabs.open(configs[row])
+			return nil
+		case 't':
+			if overlayShown(pages) {
+				return event
+			}
+			if !tabs.show() {
+				infoPopup(pages, "No shell opened, press s on a host to open one")
+			}
 			return nil
 		case 'u': // copy to
-			if pages.HasPage("popup") {
+			if overlayShown(pages) {
 				return event
 			}
 			if len(multiSelectConfigs) != 0 {
-				multiCopyTo(pages, multiSelectConfigs)
+				connectMany(app, pages, multiSelectConfigs, func() {
+					multiCopyTo(app, pages, multiSelectConfigs)
+				})
 			} else {
 				row, _ := table.GetSelection()
 				selectedConfig := configs[row]
@@ -227,11 +336,13 @@ func DisplaySSHConfig(configs []ssh.SSHConfig) {
 			}
 			return nil
 		case 'd': // copy from
-			if pages.HasPage("popup") {
+			if overlayShown(pages) {
 				return event
 			}
 			if len(multiSelectConfigs) != 0 {
-				multiCopyFrom(pages, multiSelectConfigs)
+				connectMany(app, pages, multiSelectConfigs, func() {
+					multiCopyFrom(app, pages, multiSelectConfigs)
+				})
 			} else {
 				row, _ := table.GetSelection()
 				selectedConfig := configs[row]
@@ -239,12 +350,12 @@ func DisplaySSHConfig(configs []ssh.SSHConfig) {
 			}
 			return nil
 		case 'm':
-			if pages.HasPage("popup") {
+			if overlayShown(pages) {
 				return event
 			}
 			row, _ := table.GetSelection()
 			selectedConfig := configs[row]
-			if !reachables[row].Load() {
+			if !probes.reachable(row) {
 				infoPopup(pages, fmt.Sprintf("Host %s: is not reachable", selectedConfig.Host))
 				return nil
 			}
@@ -266,12 +377,12 @@ func DisplaySSHConfig(configs []ssh.SSHConfig) {
 			}
 			return nil
 		case 'M':
-			if pages.HasPage("popup") {
+			if overlayShown(pages) {
 				return event
 			}
 			if len(multiSelectConfigs) == 0 {
 				for i := range configs {
-					if !reachables[i].Load() {
+					if !probes.reachable(i) {
 						continue
 					}
 					table.GetCell(i, 0).SetBackgroundColor(tcell.ColorBlue)
@@ -296,21 +407,63 @@ func DisplaySSHConfig(configs []ssh.SSHConfig) {
 			}
 			return nil
 		case 'e':
-			if pages.HasPage("popup") {
+			if overlayShown(pages) {
 				return event
 			}
 			if len(multiSelectConfigs) != 0 {
-				multiExecOn(pages, multiSelectConfigs)
+				multiExecOn(app, pages, multiSelectConfigs)
 			} else {
 				row, _ := table.GetSelection()
 				selectedConfig := configs[row]
-				singleExecOn(pages, selectedConfig)
+				singleExecOn(app, pages, selectedConfig)
+			}
+			return nil
+		case 'i':
+			if overlayShown(pages) {
+				return event
+			}
+			row, _ := table.GetSelection()
+			hostDetailPopup(app, pages, configs[row], probes.result(row))
+			return nil
+		case 'r':
+			if overlayShown(pages) {
+				return event
 			}
+			row, _ := table.GetSelection()
+			probes.refresh(row)
+			return nil
+		case 'R':
+			if overlayShown(pages) {
+				return event
+			}
+			for row := range configs {
+				probes.refresh(row)
+			}
+			return nil
+		case 'D':
+			if overlayShown(pages) {
+				return event
+			}
+			dashboardPage(app, pages, configs, probes)
+			return nil
+		case 'E':
+			if overlayShown(pages) {
+				return event
+			}
+			row, _ := table.GetSelection()
+			editFileOn(app, pages, configs[row])
+			return nil
+		case 'b':
+			if overlayShown(pages) {
+				return event
+			}
+			row, _ := table.GetSelection()
+			browsePairPopup(app, pages, configs, configs[row])
 			return nil
 		case '/':
 			fallthrough
 		case '?':
-			if pages.HasPage("popup") {
+			if overlayShown(pages) {
 				return event
 			}
 			searchFilterPopup("Host", pages, table, configs,
@@ -331,29 +484,6 @@ func DisplaySSHConfig(configs []ssh.SSHConfig) {
 
 var appSuspended atomic.Bool
 
-func reachabilityCheck(configs []ssh.SSHConfig, reachables []atomic.Bool, table *tview.Table, app *tview.Application) {
-	for ; ; <-time.After(2 * time.Minute) {
-		for i, config := range configs {
-			port, err := strconv.Atoi(config.Port)
-			if err != nil {
-				port = 22
-			}
-			go func(i int) {
-				if ssh.CheckSSHPort(config.HostName, port, 10*time.Second) {
-					table.GetCell(i, 0).SetTextColor(tcell.ColorDarkGreen)
-					reachables[i].Store(true)
-				} else {
-					table.GetCell(i, 0).SetTextColor(tcell.ColorDarkRed)
-					reachables[i].Store(false)
-				}
-				if !appSuspended.Load() {
-					app.Draw()
-				}
-			}(i)
-		}
-	}
-}
-
 func DirAutocomplete(currentText string) []string {
 	var dir string
 	if filepath.IsAbs(currentText) {
@@ -387,6 +517,18 @@ func DirAutocomplete(currentText string) []string {
 	return res
 }
 
+// keyGrabber is implemented by pages receiving every key, Escape included,
+// such as terminals.
+type keyGrabber interface {
+	grabKeys()
+}
+
+// overlayShown reports whether anything is displayed on top of the host table.
+func overlayShown(pages *tview.Pages) bool {
+	name, _ := pages.GetFrontPage()
+	return name != "main"
+}
+
 func infoPopup(pages *tview.Pages, msg string) {
 	popup := tview.NewModal().
 		SetText(msg).
@@ -397,6 +539,145 @@ func infoPopup(pages *tview.Pages, msg string) {
 	pages.AddPage("popup", popup, false, true)
 }
 
+// textPopup displays a scrollable, possibly long, text.
+func textPopup(pages *tview.Pages, title, text string) *tview.TextView {
+	popup := tview.NewTextView().
+		SetText(text).
+		SetScrollable(true).
+		SetDoneFunc(func(key tcell.Key) {
+			pages.RemovePage("popup")
+		})
+	popup.SetBorder(true).SetTitle(title)
+	pages.AddPage("popup", popup, true, true)
+	return popup
+}
+
+// factsMaxAge is the age after which the facts of a host are gathered again
+// when showing its details.
+const factsMaxAge = 24 * time.Hour
+
+// hostDetailPopup displays the settings of a host, its last probe and its
+// facts, gathering them in the background when missing or outdated.
+func hostDetailPopup(app *tview.Application, pages *tview.Pages, cfg ssh.SSHConfig, probe *ssh.ProbeResult) {
+	popup := textPopup(pages, " "+cfg.Host+" ", hostDetailText(cfg, probe, ""))
+	if facts, has := ssh.CachedFacts(cfg.Host); has && time.Since(facts.Collected) < factsMaxAge {
+		return
+	}
+	popup.SetText(hostDetailText(cfg, probe, "gathering..."))
+	go func() {
+		status := ""
+		err := gatherFacts(cfg)
+		if err != nil {
+			status = "error, " + err.Error()
+		}
+		app.QueueUpdateDraw(func() {
+			popup.SetText(hostDetailText(cfg, probe, status))
+		})
+	}()
+}
+
+func gatherFacts(cfg ssh.SSHConfig) error {
+	client, err := connPool.Get(cfg)
+	if err != nil {
+		return err
+	}
+	defer connPool.Put(client)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	facts, err := ssh.GatherFacts(ctx, client, cfg.Host)
+	if err != nil {
+		return err
+	}
+	return ssh.StoreFacts(facts)
+}
+
+// hostDetailText describes a host, factsStatus tells how gathering its facts
+// is going.
+func hostDetailText(cfg ssh.SSHConfig, probe *ssh.ProbeResult, factsStatus string) string {
+	var text strings.Builder
+	write := func(fields [][2]string) {
+		for _, field := range fields {
+			if field[1] != "" {
+				fmt.Fprintf(&text, "%-17s %s\n", field[0]+":", field[1])
+			}
+		}
+	}
+
+	auth := "All"
+	if cfg.Password != "" && cfg.IdentityFile == "" {
+		auth = "Passwd"
+	} else if cfg.IdentityFile != "" {
+		auth = "Key (" + cfg.IdentityFile + ")"
+	}
+	interval, countMax := cfg.KeepAlive()
+	keepAlive := "disabled"
+	if interval > 0 {
+		keepAlive = fmt.Sprintf("every %s, %d unanswered max", interval, countMax)
+	}
+	connected := "no"
+	if connPool.Connected(cfg.Host) {
+		connected = "yes"
+	}
+	var env []string
+	for _, v := range cfg.Environment() {
+		env = append(env, v.Name)
+	}
+	write([][2]string{
+		{"HostName", cfg.HostName},
+		{"Port", cfg.Port},
+		{"User", cfg.User},
+		{"Auth", auth},
+		{"RemoteCommand", cfg.RemoteCommand},
+		{"RequestTTY", cfg.RequestTTY},
+		{"Keepalive", keepAlive},
+		{"Agent forwarding", cfg.AgentForwarding()},
+		{"Environment", strings.Join(env, " ")},
+		{"Connected", connected},
+	})
+
+	if probe != nil {
+		status := probe.Status.String()
+		if probe.Err != nil && probe.Status != ssh.ProbeHostKeyMismatch {
+			status += " (" + probe.Err.Error() + ")"
+		}
+		hostKey := probe.Fingerprint
+		switch {
+		case hostKey == "" || probe.KnownHostKey:
+		case probe.Status == ssh.ProbeHostKeyMismatch:
+			hostKey += " (differs from known_hosts)"
+		default:
+			hostKey += " (not in known_hosts)"
+		}
+		latency := ""
+		if probe.Latency > 0 {
+			latency = probe.Latency.Round(10 * time.Microsecond).String()
+		}
+		text.WriteString("\n")
+		write([][2]string{
+			{"Status", status},
+			{"Server", probe.Banner},
+			{"Host key", hostKey},
+			{"Latency", latency},
+			{"Checked", probe.Checked.Format(time.DateTime)},
+		})
+	}
+
+	text.WriteString("\n")
+	facts, has := ssh.CachedFacts(cfg.Host)
+	collected := "never"
+	if has {
+		collected = facts.Collected.Format(time.DateTime)
+	}
+	if factsStatus != "" {
+		collected += ", " + factsStatus
+	}
+	write([][2]string{{"Facts collected", collected}})
+	if has {
+		write(facts.Summary())
+	}
+	return text.String()
+}
+
 func searchFilterPopup(fieldName string, pages *tview.Pages, table *tview.Table,
 	configs []ssh.SSHConfig,
 	match func(cfg ssh.SSHConfig, inputText string) bool,
@@ -431,11 +712,37 @@ func searchFilterPopup(fieldName string, pages *tview.Pages, table *tview.Table,
 	pages.AddPage("popup", popup, false, true)
 }
 
-func singleCopyTo(pages *tview.Pages, selectedConfig ssh.SSHConfig) {
-	client, err := ssh.SSHClient(selectedConfig)
+// connect opens, or reuses, the pooled connection to the host before a popup
+// is displayed, so that connection errors are reported right away.
+func connect(pages *tview.Pages, selectedConfig ssh.SSHConfig) bool {
+	client, err := connPool.Get(selectedConfig)
 	if err != nil {
 		infoPopup(pages, fmt.Sprintf("Error accessing ssh for Host %s: %v",
 			selectedConfig.Host, err))
+		return false
+	}
+	connPool.Put(client)
+	return true
+}
+
+// connectMany is connect for multiple hosts. The hosts are connected in the
+// background and show is called from the UI goroutine once they all are.
+func connectMany(app *tview.Application, pages *tview.Pages, selectedConfigs []ssh.SSHConfig, show func()) {
+	go func() {
+		clients, err := connPool.GetMany(selectedConfigs)
+		connPool.PutMany(clients)
+		app.QueueUpdateDraw(func() {
+			if err != nil {
+				infoPopup(pages, err.Error())
+				return
+			}
+			show()
+		})
+	}()
+}
+
+func singleCopyTo(pages *tview.Pages, selectedConfig ssh.SSHConfig) {
+	if !connect(pages, selectedConfig) {
 		return
 	}
 	prevValues := ssh.GetSCPUploadEntry(selectedConfig.Host)
@@ -453,8 +760,15 @@ func singleCopyTo(pages *tview.Pages, selectedConfig ssh.SSHConfig) {
 			From: fromField.GetText(),
 			To:   toField.GetText(),
 		})
-		err := ssh.UploadFile(client, fromField.GetText(), toField.GetText(), nil)
 		pages.RemovePage("popup")
+		client, err := connPool.Get(selectedConfig)
+		if err != nil {
+			infoPopup(pages, fmt.Sprintf("Error accessing ssh for Host %s: %v",
+				selectedConfig.Host, err))
+			return
+		}
+		defer connPool.Put(client)
+		err = ssh.UploadFile(client, fromField.GetText(), toField.GetText(), nil)
 		if err != nil {
 			infoPopup(pages,
 				fmt.Sprintf("Error uploading %s -> %s: %v",
@@ -470,13 +784,7 @@ func singleCopyTo(pages *tview.Pages, selectedConfig ssh.SSHConfig) {
 	pages.AddPage("popup", popup, true, true)
 }
 
-func multiCopyTo(pages *tview.Pages, selectedConfigs []ssh.SSHConfig) {
-	clients, err := ssh.InitMultiClients(selectedConfigs)
-	if err != nil {
-		infoPopup(pages, err.Error())
-		return
-	}
-
+func multiCopyTo(app *tview.Application, pages *tview.Pages, selectedConfigs []ssh.SSHConfig) {
 	prevValues := ssh.GetSCPUploadEntry(selectedConfigs[0].Host)
 	popup := tview.NewForm()
 	fromField := tview.NewInputField().SetFieldWidth(256).SetText(prevValues.From)
@@ -489,24 +797,39 @@ func multiCopyTo(pages *tview.Pages, selectedConfigs []ssh.SSHConfig) {
 	popup.AddFormItem(toField)
 
 	popup.AddButton("Upload", func() {
-		successCount := 0
-		for i := range clients {
+		from, to := fromField.GetText(), toField.GetText()
+		for i := range selectedConfigs {
 			ssh.PutSCPUploadEntry(selectedConfigs[i].Host, ssh.SCPHistoryEntry{
-				From: fromField.GetText(),
-				To:   toField.GetText(),
+				From: from,
+				To:   to,
 			})
-			err := ssh.UploadFile(clients[i], fromField.GetText(), toField.GetText(), nil)
-			if err != nil {
-				infoPopup(pages,
-					fmt.Sprintf("Error uploading %s -> %s: %v",
-						fromField.GetText(),
-						toField.GetText(), err))
-			} else {
-				successCount++
-			}
 		}
 		pages.RemovePage("popup")
-		infoPopup(pages, fmt.Sprintf("Successfully uploaded: %d/%d", successCount, len(clients)))
+		go func() {
+			clients, err := connPool.GetMany(selectedConfigs)
+			defer connPool.PutMany(clients)
+			if err != nil {
+				app.QueueUpdateDraw(func() {
+					infoPopup(pages, err.Error())
+				})
+				return
+			}
+			var msgs []string
+			successCount := 0
+			for i := range clients {
+				err := ssh.UploadFile(clients[i], from, to, nil)
+				if err != nil {
+					msgs = append(msgs, fmt.Sprintf("Error uploading %s -> %s on %s: %v",
+						from, to, selectedConfigs[i].Host, err))
+				} else {
+					successCount++
+				}
+			}
+			msgs = append(msgs, fmt.Sprintf("Successfully uploaded: %d/%d", successCount, len(clients)))
+			app.QueueUpdateDraw(func() {
+				infoPopup(pages, strings.Join(msgs, "\n"))
+			})
+		}()
 	})
 	popup.SetCancelFunc(func() {
 		pages.RemovePage("popup")
@@ -514,34 +837,47 @@ func multiCopyTo(pages *tview.Pages, selectedConfigs []ssh.SSHConfig) {
 	pages.AddPage("popup", popup, true, true)
 }
 
-func singleExecOn(pages *tview.Pages, selectedConfig ssh.SSHConfig) {
-	client, err := ssh.SSHClient(selectedConfig)
-	if err != nil {
-		infoPopup(pages, fmt.Sprintf("Error accessing ssh for Host %s: %v",
-			selectedConfig.Host, err))
+func singleExecOn(app *tview.Application, pages *tview.Pages, selectedConfig ssh.SSHConfig) {
+	if !connect(pages, selectedConfig) {
 		return
 	}
 	prevValues := ssh.GetExecEntry(selectedConfig.Host)
 	popup := tview.NewForm()
 	cmdField := tview.NewInputField().SetFieldWidth(256).SetText(prevValues.Command)
-	cmdField.SetLabel("Command: ").
-		SetAutocompleteFunc(DirAutocomplete)
+	cmdField.SetLabel("Command (or script args, @snippet): ").
+		SetAutocompleteFunc(commandAutocomplete)
 	popup.AddFormItem(cmdField)
-	popup.AddButton("Execute", func() {
+	scriptField := tview.NewInputField().SetFieldWidth(256)
+	scriptField.SetLabel("Local script (optional): ").
+		SetAutocompleteFunc(DirAutocomplete)
+	popup.AddFormItem(scriptField)
+	sudoField := tview.NewCheckbox().SetLabel("Run with sudo: ")
+	popup.AddFormItem(sudoField)
+	execute := func(cmdText string) {
+		label, command, stdin, err := scriptCommand(scriptField.GetText(), cmdText)
+		if err != nil {
+			infoPopup(pages, err.Error())
+			return
+		}
+		if sudoField.IsChecked() {
+			command = ssh.SudoCommand(command)
+			stdin = ssh.SudoStdin(selectedConfig.SudoSecret(), stdin)
+			label = "sudo " + label
+		}
 		ssh.PutExecEntry(selectedConfig.Host, ssh.ExecHistoryEntry{
 			Command: cmdField.GetText(),
 		})
-		b, err := ssh.ExecCommand(client, cmdField.GetText())
 		pages.RemovePage("popup")
+		client, err := connPool.Get(selectedConfig)
 		if err != nil {
-			infoPopup(pages,
-				fmt.Sprintf("Error executing %s on %s: %v",
-					cmdField.GetText(),
-					selectedConfig.Host,
-					err))
-		} else {
-			infoPopup(pages, fmt.Sprintf("Successfully executed:\n%s\n", string(b)))
+			infoPopup(pages, fmt.Sprintf("Error accessing ssh for Host %s: %v",
+				selectedConfig.Host, err))
+			return
 		}
+		execOutputPage(app, pages, selectedConfig.Host, client, label, command, stdin)
+	}
+	popup.AddButton("Execute", func() {
+		withSnippet(pages, cmdField.GetText(), execute)
 	})
 	popup.SetCancelFunc(func() {
 		pages.RemovePage("popup")
@@ -549,39 +885,119 @@ func singleExecOn(pages *tview.Pages, selectedConfig ssh.SSHConfig) {
 	pages.AddPage("popup", popup, true, true)
 }
 
-func multiExecOn(pages *tview.Pages, selectedConfigs []ssh.SSHConfig) {
-	clients, err := ssh.InitMultiClients(selectedConfigs)
-	if err != nil {
-		infoPopup(pages, err.Error())
-		return
-	}
-
+func multiExecOn(app *tview.Application, pages *tview.Pages, selectedConfigs []ssh.SSHConfig) {
 	prevValues := ssh.GetExecEntry(selectedConfigs[0].Host)
 	popup := tview.NewForm()
 	cmdField := tview.NewInputField().SetFieldWidth(256).SetText(prevValues.Command)
-	cmdField.SetLabel("Command: ").
-		SetAutocompleteFunc(DirAutocomplete)
+	cmdField.SetLabel("Command (or script args, @snippet): ").
+		SetAutocompleteFunc(commandAutocomplete)
 	popup.AddFormItem(cmdField)
+	scriptField := tview.NewInputField().SetFieldWidth(256)
+	scriptField.SetLabel("Local script (optional): ").
+		SetAutocompleteFunc(DirAutocomplete)
+	popup.AddFormItem(scriptField)
+	sudoField := tview.NewCheckbox().SetLabel("Run with sudo: ")
+	popup.AddFormItem(sudoField)
+	parallelismField := tview.NewInputField().SetFieldWidth(8).
+		SetText(strconv.Itoa(ssh.DefaultParallelism)).
+		SetAcceptanceFunc(tview.InputFieldInteger)
+	parallelismField.SetLabel("Parallelism (0: all): ")
+	popup.AddFormItem(parallelismField)
+	timeoutField := tview.NewInputField().SetFieldWidth(8)
+	timeoutField.SetLabel("Timeout per host (e.g. 30s): ")
+	popup.AddFormItem(timeoutField)
+	deadlineField := tview.NewInputField().SetFieldWidth(8)
+	deadlineField.SetLabel("Global deadline (e.g. 5m): ")
+	popup.AddFormItem(deadlineField)
+	batchField := tview.NewInputField().SetFieldWidth(8)
+	batchField.SetLabel("Rolling batch (N or N%): ")
+	popup.AddFormItem(batchField)
+	pauseField := tview.NewInputField().SetFieldWidth(8)
+	pauseField.SetLabel("Pause between batches: ")
+	popup.AddFormItem(pauseField)
+	healthField := tview.NewInputField().SetFieldWidth(256)
+	healthField.SetLabel("Health check command: ")
+	popup.AddFormItem(healthField)
+	failFastField := tview.NewCheckbox().SetLabel("Abort on first failure: ")
+	popup.AddFormItem(failFastField)
 
-	successCount := 0
-	popup.AddButton("Execute on all", func() {
-		for i := range clients {
+	execute := func(cmdText string) {
+		var opts ssh.MultiExecOptions
+		var err error
+		opts.Parallelism, _ = strconv.Atoi(parallelismField.GetText())
+		opts.Timeout, err = parseOptionalDuration(timeoutField.GetText())
+		if err != nil {
+			infoPopup(pages, fmt.Sprintf("Invalid timeout: %v", err))
+			return
+		}
+		opts.Deadline, err = parseOptionalDuration(deadlineField.GetText())
+		if err != nil {
+			infoPopup(pages, fmt.Sprintf("Invalid deadline: %v", err))
+			return
+		}
+		var rolling ssh.RollingOptions
+		rolling.BatchSize, rolling.BatchPercent, err = ssh.ParseBatch(batchField.GetText())
+		if err != nil {
+			infoPopup(pages, err.Error())
+			return
+		}
+		rolling.Pause, err = parseOptionalDuration(pauseField.GetText())
+		if err != nil {
+			infoPopup(pages, fmt.Sprintf("Invalid pause: %v", err))
+			return
+		}
+		rolling.HealthCheck = healthField.GetText()
+		rolling.FailFast = failFastField.IsChecked()
+		rolling.Pool = connPool
+
+		label, command, stdin, err := scriptCommand(scriptField.GetText(), cmdText)
+		if err != nil {
+			infoPopup(pages, err.Error())
+			return
+		}
+		opts.Stdin = stdin
+		if sudoField.IsChecked() {
+			opts.Sudo = true
+			opts.SudoPasswords = ssh.SudoPasswords(selectedConfigs)
+			label = "sudo " + label
+		}
+		hosts := make([]string, len(selectedConfigs))
+		for i := range selectedConfigs {
+			hosts[i] = selectedConfigs[i].Host
 			ssh.PutExecEntry(selectedConfigs[i].Host, ssh.ExecHistoryEntry{
 				Command: cmdField.GetText(),
 			})
-			_, err := ssh.ExecCommand(clients[i], cmdField.GetText())
-			if err != nil {
-				infoPopup(pages,
-					fmt.Sprintf("Error executing %s on %s: %v",
-						cmdField.GetText(),
-						selectedConfigs[i].Host,
-						err))
-			} else {
-				successCount++
-			}
 		}
 		pages.RemovePage("popup")
-		infoPopup(pages, fmt.Sprintf("Successfully executed: %d/%d", successCount, len(clients)))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		view := resultsPage(pages, label, hosts, cancel)
+		onResult := func(i int, res ssh.ExecResult) {
+			app.QueueUpdateDraw(func() {
+				view.update(i, res)
+			})
+		}
+		go func() {
+			defer cancel()
+			if !rolling.Enabled() {
+				connPool.ExecOnMany(ctx, selectedConfigs, command, opts, onResult)
+				return
+			}
+			rolling.OnBatch = func(batch, batches int, hosts []string) {
+				app.QueueUpdateDraw(func() {
+					view.setStatus(fmt.Sprintf("batch %d/%d", batch, batches))
+				})
+			}
+			_, abort := ssh.RollingExec(ctx, selectedConfigs, command, opts, rolling, onResult)
+			if abort != nil {
+				app.QueueUpdateDraw(func() {
+					view.setStatus(fmt.Sprintf("aborted, %v", abort))
+				})
+			}
+		}()
+	}
+	popup.AddButton("Execute on all", func() {
+		withSnippet(pages, cmdField.GetText(), execute)
 	})
 	popup.SetCancelFunc(func() {
 		pages.RemovePage("popup")
@@ -589,11 +1005,16 @@ func multiExecOn(pages *tview.Pages, selectedConfigs []ssh.SSHConfig) {
 	pages.AddPage("popup", popup, true, true)
 }
 
+// parseOptionalDuration parses a duration, an empty text means no duration.
+func parseOptionalDuration(text string) (time.Duration, error) {
+	if strings.TrimSpace(text) == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(strings.TrimSpace(text))
+}
+
 func singleCopyFrom(pages *tview.Pages, selectedConfig ssh.SSHConfig) {
-	client, err := ssh.SSHClient(selectedConfig)
-	if err != nil {
-		infoPopup(pages, fmt.Sprintf("Error accessing ssh for Host %s: %v",
-			selectedConfig.Host, err))
+	if !connect(pages, selectedConfig) {
 		return
 	}
 	prevValues := ssh.GetSCPDownloadEntry(selectedConfig.Host)
@@ -612,8 +1033,15 @@ func singleCopyFrom(pages *tview.Pages, selectedConfig ssh.SSHConfig) {
 			From: fromField.GetText(),
 			To:   toField.GetText(),
 		})
-		err := ssh.DownloadFile(client, fromField.GetText(), toField.GetText(), nil)
 		pages.RemovePage("popup")
+		client, err := connPool.Get(selectedConfig)
+		if err != nil {
+			infoPopup(pages, fmt.Sprintf("Error accessing ssh for Host %s: %v",
+				selectedConfig.Host, err))
+			return
+		}
+		defer connPool.Put(client)
+		err = ssh.DownloadFile(client, fromField.GetText(), toField.GetText(), nil)
 		if err != nil {
 			infoPopup(pages,
 				fmt.Sprintf("Error downloading %s -> %s: %v",
@@ -629,13 +1057,7 @@ func singleCopyFrom(pages *tview.Pages, selectedConfig ssh.SSHConfig) {
 	pages.AddPage("popup", popup, true, true)
 }
 
-func multiCopyFrom(pages *tview.Pages, selectedConfigs []ssh.SSHConfig) {
-	clients, err := ssh.InitMultiClients(selectedConfigs)
-	if err != nil {
-		infoPopup(pages, err.Error())
-		return
-	}
-
+func multiCopyFrom(app *tview.Application, pages *tview.Pages, selectedConfigs []ssh.SSHConfig) {
 	prevValues := ssh.GetSCPDownloadEntry(selectedConfigs[0].Host)
 	popup := tview.NewForm()
 	fromField := tview.NewInputField()
@@ -652,25 +1074,82 @@ func multiCopyFrom(pages *tview.Pages, selectedConfigs []ssh.SSHConfig) {
 			infoPopup(pages, "Please specify a * in the 'To:' to differentiate the downloaded files\nfor instance: /tmp/toto_*.tar.gz or /tmp/*/toto.tar.gz")
 			return
 		}
-		successCount := 0
-		for i := range clients {
+		from, to := fromField.GetText(), toField.GetText()
+		for i := range selectedConfigs {
 			ssh.PutSCPDownloadEntry(selectedConfigs[i].Host, ssh.SCPHistoryEntry{
-				From: fromField.GetText(),
-				To:   toField.GetText(),
+				From: from,
+				To:   to,
 			})
-			toPath := strings.ReplaceAll(toField.GetText(), "*", selectedConfigs[i].Host)
-			err := ssh.DownloadFile(clients[i], fromField.GetText(), toPath, nil)
+		}
+		pages.RemovePage("popup")
+		go func() {
+			clients, err := connPool.GetMany(selectedConfigs)
+			defer connPool.PutMany(clients)
 			if err != nil {
-				infoPopup(pages,
-					fmt.Sprintf("Error downloading %s -> %s: %v",
-						fromField.GetText(),
-						toPath, err))
-			} else {
-				successCount++
+				app.QueueUpdateDraw(func() {
+					infoPopup(pages, err.Error())
+				})
+				return
 			}
-		}
+			var msgs []string
+			successCount := 0
+			for i := range clients {
+				toPath := strings.ReplaceAll(to, "*", selectedConfigs[i].Host)
+				err := ssh.DownloadFile(clients[i], from, toPath, nil)
+				if err != nil {
+					msgs = append(msgs, fmt.Sprintf("Error downloading %s -> %s: %v",
+						from, toPath, err))
+				} else {
+					successCount++
+				}
+			}
+			msgs = append(msgs, fmt.Sprintf("Successfully downloaded: %d/%d", successCount, len(clients)))
+			app.QueueUpdateDraw(func() {
+				infoPopup(pages, strings.Join(msgs, "\n"))
+			})
+		}()
+	})
+	popup.SetCancelFunc(func() {
+		pages.RemovePage("popup")
+	})
+	pages.AddPage("popup", popup, true, true)
+}
+
+func editFileOn(app *tview.Application, pages *tview.Pages, selectedConfig ssh.SSHConfig) {
+	if !connect(pages, selectedConfig) {
+		return
+	}
+	popup := tview.NewForm()
+	fileField := tview.NewInputField().SetFieldWidth(256)
+	fileField.SetLabel("File (remote): ")
+	popup.AddFormItem(fileField)
+	popup.AddButton("Edit", func() {
 		pages.RemovePage("popup")
-		infoPopup(pages, fmt.Sprintf("Successfully downloaded: %d/%d", successCount, len(clients)))
+		remotePath := fileField.GetText()
+		client, err := connPool.Get(selectedConfig)
+		if err != nil {
+			infoPopup(pages, fmt.Sprintf("Error accessing ssh for Host %s: %v",
+				selectedConfig.Host, err))
+			return
+		}
+		defer connPool.Put(client)
+		app.Suspend(func() {
+			appSuspended.Store(true)
+			defer appSuspended.Store(false)
+			err = ssh.EditRemoteFile(client, remotePath)
+		})
+		var changedErr *ssh.RemoteChangedError
+		switch {
+		case err == nil:
+			infoPopup(pages, fmt.Sprintf("Successfully saved %s", remotePath))
+		case errors.Is(err, ssh.ErrFileUnchanged):
+			infoPopup(pages, fmt.Sprintf("No changes to %s", remotePath))
+		case errors.As(err, &changedErr):
+			textPopup(pages, " "+changedErr.Error()+" ", changedErr.Diff)
+		default:
+			infoPopup(pages, fmt.Sprintf("Error editing %s on %s: %v",
+				remotePath, selectedConfig.Host, err))
+		}
 	})
 	popup.SetCancelFunc(func() {
 		pages.RemovePage("popup")